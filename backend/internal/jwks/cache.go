@@ -0,0 +1,164 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type cachedKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// Cache fetches a remote JWKS and keeps it for TTL. A token signed with an
+// unknown kid triggers an early refetch, which picks up keys the auth service
+// rotated in since the last fetch. Fetches are attempted at most once per
+// MinRefresh so bogus kids or an unreachable auth service can't flood it.
+type Cache struct {
+	URL        string
+	TTL        time.Duration
+	MinRefresh time.Duration
+	Client     *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]cachedKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	// fetching is closed when the fetch in flight completes
+	fetching chan struct{}
+}
+
+func NewCache(url string, ttl time.Duration) *Cache {
+	return &Cache{
+		URL:        url,
+		TTL:        ttl,
+		MinRefresh: 10 * time.Second,
+		Client:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Keyfunc resolves the verification key for token by its kid header.
+func (c *Cache) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	k, err := c.lookup(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != k.alg {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+	}
+	return k.key, nil
+}
+
+func (c *Cache) lookup(ctx context.Context, kid string) (cachedKey, error) {
+	c.mu.Lock()
+	k, known := c.keys[kid]
+	due := c.keys == nil || time.Since(c.fetchedAt) > c.TTL || !known
+	if !due {
+		c.mu.Unlock()
+		return k, nil
+	}
+
+	// Only one request fetches; the lock isn't held meanwhile, so tokens with
+	// known keys keep verifying while the auth service is slow.
+	if fetching := c.fetching; fetching != nil {
+		c.mu.Unlock()
+		if known {
+			return k, nil
+		}
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return cachedKey{}, ctx.Err()
+		}
+		return c.cached(kid)
+	}
+	if time.Since(c.attemptedAt) <= c.MinRefresh {
+		c.mu.Unlock()
+		if !known {
+			return cachedKey{}, fmt.Errorf("unknown key %s", kid)
+		}
+		return k, nil
+	}
+	c.attemptedAt = time.Now()
+	fetching := make(chan struct{})
+	c.fetching = fetching
+	c.mu.Unlock()
+
+	keys, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	if err == nil {
+		c.keys = keys
+		c.fetchedAt = time.Now()
+	}
+	c.fetching = nil
+	close(fetching)
+	c.mu.Unlock()
+
+	if err != nil {
+		// Keep serving the last good set while the auth service is unreachable.
+		if !known {
+			return cachedKey{}, err
+		}
+		log.Printf("Failed to refresh JWKS, using cached keys: %v", err)
+		return k, nil
+	}
+	return c.cached(kid)
+}
+
+func (c *Cache) cached(kid string) (cachedKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k, known := c.keys[kid]
+	if !known {
+		return cachedKey{}, fmt.Errorf("unknown key %s", kid)
+	}
+	return k, nil
+}
+
+// fetch downloads and parses the key set without touching the cache.
+func (c *Cache) fetch(ctx context.Context) (map[string]cachedKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: status %d", c.URL, resp.StatusCode)
+	}
+
+	var set Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", c.URL, err)
+	}
+
+	keys := make(map[string]cachedKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		pub, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %s: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = cachedKey{alg: jwk.Alg, key: pub}
+	}
+	return keys, nil
+}
@@ -0,0 +1,143 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWKRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaJWK, err := FromPublicKey("rsa-1", &rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("FromPublicKey(rsa) error: %v", err)
+	}
+	got, err := rsaJWK.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey() error: %v", err)
+	}
+	if !rsaKey.PublicKey.Equal(got) {
+		t.Error("RSA key did not round-trip")
+	}
+
+	edJWK, err := FromPublicKey("ed-1", edPub)
+	if err != nil {
+		t.Fatalf("FromPublicKey(ed25519) error: %v", err)
+	}
+	if edJWK.Alg != "EdDSA" || edJWK.Crv != "Ed25519" {
+		t.Errorf("unexpected JWK %+v", edJWK)
+	}
+	got, err = edJWK.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey() error: %v", err)
+	}
+	if !edPub.Equal(got) {
+		t.Error("Ed25519 key did not round-trip")
+	}
+}
+
+func TestCacheKeyfunc(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	jwk, _ := FromPublicKey("key-1", pub)
+
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		_ = json.NewEncoder(w).Encode(Set{Keys: []JWK{jwk}})
+	}))
+	defer srv.Close()
+
+	cache := NewCache(srv.URL, time.Minute)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{Subject: "user"})
+	token.Header["kid"] = "key-1"
+	signed, _ := token.SignedString(priv)
+	if _, err := jwt.Parse(signed, cache.Keyfunc); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if _, err := jwt.Parse(signed, cache.Keyfunc); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+
+	// Unknown kids are rejected without refetching inside MinRefresh.
+	token.Header["kid"] = "key-2"
+	signed, _ = token.SignedString(priv)
+	if _, err := jwt.Parse(signed, cache.Keyfunc); err == nil {
+		t.Error("Parse() accepted a token with an unknown kid")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+
+	// A key may not be used with another algorithm than the one it was published for.
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "user"})
+	hs.Header["kid"] = "key-1"
+	signed, _ = hs.SignedString([]byte(pub))
+	if _, err := jwt.Parse(signed, cache.Keyfunc); err == nil {
+		t.Error("Parse() accepted an HS256 token signed with the public key")
+	}
+}
+
+// A slow refresh doesn't hold up tokens whose key is already cached.
+func TestCacheRefreshDoesNotBlock(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	jwk, _ := FromPublicKey("key-1", pub)
+
+	release := make(chan struct{})
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		_ = json.NewEncoder(w).Encode(Set{Keys: []JWK{jwk}})
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	cache := NewCache(srv.URL, time.Millisecond)
+	cache.MinRefresh = 0
+	ctx := context.Background()
+	if _, err := cache.lookup(ctx, "key-1"); err != nil {
+		t.Fatalf("lookup() error: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	go cache.lookup(ctx, "key-1")
+	for atomic.LoadInt32(&fetches) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.lookup(ctx, "key-1")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("lookup() error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lookup() waited for the refresh in flight")
+	}
+}
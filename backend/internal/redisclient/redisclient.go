@@ -0,0 +1,31 @@
+// Package redisclient builds the Redis client shared by the services from
+// the REDIS_* environment variables.
+package redisclient
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func FromEnv() *redis.Client {
+	dbIndex, err := strconv.Atoi(getEnv("REDIS_DB", "0"))
+	if err != nil {
+		dbIndex = 0
+	}
+
+	return redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%s", getEnv("REDIS_HOST", "localhost"), getEnv("REDIS_PORT", "6379")),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       dbIndex,
+	})
+}
@@ -0,0 +1,83 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type userCutoff struct {
+	at        time.Time
+	expiresAt time.Time
+}
+
+// MemoryStore keeps revocations in process memory. Entries are dropped once
+// the tokens they cover have expired.
+type MemoryStore struct {
+	mu        sync.Mutex
+	tokens    map[string]time.Time
+	users     map[string]userCutoff
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]userCutoff),
+		now:    time.Now,
+	}
+}
+
+func (s *MemoryStore) RevokeToken(_ context.Context, jti string, ttl time.Duration) error {
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	s.tokens[jti] = now.Add(ttl)
+	return nil
+}
+
+func (s *MemoryStore) RevokeUser(_ context.Context, userID string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	s.users[userID] = userCutoff{at: cutoff(now), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) IsRevoked(_ context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+
+	if expiresAt, ok := s.tokens[jti]; ok && jti != "" && now.Before(expiresAt) {
+		return true, nil
+	}
+	if u, ok := s.users[userID]; ok && now.Before(u.expiresAt) && issuedAt.Before(u.at) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// sweep drops expired entries at most once a minute. Callers hold s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(time.Minute)
+	for jti, expiresAt := range s.tokens {
+		if !now.Before(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for userID, u := range s.users {
+		if !now.Before(u.expiresAt) {
+			delete(s.users, userID)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreRevokeToken(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	if err := s.RevokeToken(ctx, "jti-1", time.Minute); err != nil {
+		t.Fatalf("RevokeToken() error: %v", err)
+	}
+
+	if revoked, _ := s.IsRevoked(ctx, "jti-1", "user", now.Add(-time.Hour)); !revoked {
+		t.Error("IsRevoked() = false for revoked jti")
+	}
+	if revoked, _ := s.IsRevoked(ctx, "jti-2", "user", now.Add(-time.Hour)); revoked {
+		t.Error("IsRevoked() = true for another jti")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if revoked, _ := s.IsRevoked(ctx, "jti-1", "user", now.Add(-time.Hour)); revoked {
+		t.Error("IsRevoked() = true after the revocation expired")
+	}
+}
+
+func TestMemoryStoreRevokeUser(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 15, 10, 0, 0, 500, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	if err := s.RevokeUser(ctx, "user-1", time.Hour); err != nil {
+		t.Fatalf("RevokeUser() error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		userID   string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued before", "user-1", now.Add(-time.Minute), true},
+		{"issued in the same second", "user-1", now.Truncate(time.Second), false},
+		{"issued after", "user-1", now.Add(time.Second), false},
+		{"other user", "user-2", now.Add(-time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.IsRevoked(ctx, "", tt.userID, tt.issuedAt)
+			if err != nil {
+				t.Fatalf("IsRevoked() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
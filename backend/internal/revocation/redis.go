@@ -0,0 +1,51 @@
+package revocation
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps revocations in Redis with key expiry matching the
+// lifetime of the revoked tokens.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func tokenKey(jti string) string   { return "revoked:jti:" + jti }
+func userKey(userID string) string { return "revoked:user:" + userID }
+
+func (s *RedisStore) RevokeToken(ctx context.Context, jti string, ttl time.Duration) error {
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, tokenKey(jti), 1, ttl).Err()
+}
+
+func (s *RedisStore) RevokeUser(ctx context.Context, userID string, ttl time.Duration) error {
+	return s.client.Set(ctx, userKey(userID), cutoff(time.Now()).Unix(), ttl).Err()
+}
+
+func (s *RedisStore) IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	values, err := s.client.MGet(ctx, tokenKey(jti), userKey(userID)).Result()
+	if err != nil {
+		return false, err
+	}
+	if jti != "" && values[0] != nil {
+		return true, nil
+	}
+	if raw, ok := values[1].(string); ok {
+		at, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		return issuedAt.Before(time.Unix(at, 0)), nil
+	}
+	return false, nil
+}
@@ -0,0 +1,49 @@
+// Package revocation tracks access tokens that were revoked before they
+// expired. Both services consult the same store, so a logout performed in
+// the auth service is honored by the hydration service as well.
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"hydration-tracking/internal/redisclient"
+)
+
+type Store interface {
+	// RevokeToken revokes a single token by its jti for the rest of its lifetime.
+	RevokeToken(ctx context.Context, jti string, ttl time.Duration) error
+	// RevokeUser revokes every token issued to the user before now.
+	// ttl must cover the longest lifetime of an outstanding token.
+	RevokeUser(ctx context.Context, userID string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error)
+}
+
+var (
+	sharedMemory     *MemoryStore
+	sharedMemoryOnce sync.Once
+)
+
+// FromEnv selects the store with REVOCATION_STORE ("memory" or "redis").
+// The memory store is shared by every service in the process, which covers
+// running both services from the combined main.go binary.
+func FromEnv() (Store, error) {
+	switch kind := os.Getenv("REVOCATION_STORE"); kind {
+	case "", "memory":
+		sharedMemoryOnce.Do(func() { sharedMemory = NewMemoryStore() })
+		return sharedMemory, nil
+	case "redis":
+		return NewRedisStore(redisclient.FromEnv()), nil
+	default:
+		return nil, fmt.Errorf("unknown REVOCATION_STORE %q", kind)
+	}
+}
+
+// cutoff truncates to whole seconds because JWT iat has second precision;
+// a token issued in the same second as the revocation stays valid.
+func cutoff(now time.Time) time.Time {
+	return now.Truncate(time.Second)
+}
@@ -0,0 +1,27 @@
+// Package tz resolves the IANA time zones stored in user profiles. The zone
+// database is embedded so lookups work in minimal container images.
+package tz
+
+import (
+	"errors"
+	"time"
+	_ "time/tzdata"
+)
+
+// Default is the zone of users who haven't picked one.
+const Default = "UTC"
+
+var ErrUnknownZone = errors.New("unknown time zone")
+
+// Load returns the location named by an IANA zone name such as
+// "Asia/Vladivostok". The server-dependent "Local" is rejected.
+func Load(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, ErrUnknownZone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrUnknownZone
+	}
+	return loc, nil
+}
@@ -0,0 +1,21 @@
+package tz
+
+import "testing"
+
+func TestLoad(t *testing.T) {
+	for _, name := range []string{"UTC", "Asia/Vladivostok", "America/New_York"} {
+		loc, err := Load(name)
+		if err != nil {
+			t.Errorf("Load(%q) error: %v", name, err)
+			continue
+		}
+		if loc.String() != name {
+			t.Errorf("Load(%q) = %v", name, loc)
+		}
+	}
+	for _, name := range []string{"", "Local", "Mars/Olympus_Mons", "../etc/passwd"} {
+		if _, err := Load(name); err == nil {
+			t.Errorf("Load(%q) accepted an invalid zone", name)
+		}
+	}
+}
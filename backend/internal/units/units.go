@@ -0,0 +1,78 @@
+// Package units converts between the volume units users can pick and the
+// milliliters everything is stored in.
+//
+// Each unit has a display precision coarse enough that converting an amount
+// to whole milliliters and back returns exactly the same amount: a step of
+// 0.1 fl oz or 0.01 cup is more than 2 ml, while rounding to milliliters is
+// off by at most 0.5 ml.
+package units
+
+import (
+	"errors"
+	"math"
+)
+
+type Unit string
+
+const (
+	Milliliter   Unit = "ml"
+	FluidOunceUS Unit = "fl_oz_us"
+	FluidOunceUK Unit = "fl_oz_uk"
+	CupUS        Unit = "cup_us"
+)
+
+// Default is the unit of users who haven't picked one.
+const Default = Milliliter
+
+var (
+	ErrUnknownUnit = errors.New("unit must be ml, fl_oz_us, fl_oz_uk or cup_us")
+	ErrTooPrecise  = errors.New("amount has more decimal places than the unit allows")
+)
+
+type definition struct {
+	milliliters float64
+	decimals    int
+}
+
+var definitions = map[Unit]definition{
+	Milliliter:   {milliliters: 1, decimals: 0},
+	FluidOunceUS: {milliliters: 29.5735295625, decimals: 1},
+	FluidOunceUK: {milliliters: 28.4130625, decimals: 1},
+	CupUS:        {milliliters: 236.5882365, decimals: 2},
+}
+
+func Parse(name string) (Unit, error) {
+	u := Unit(name)
+	if _, ok := definitions[u]; !ok {
+		return "", ErrUnknownUnit
+	}
+	return u, nil
+}
+
+// Decimals is the number of decimal places amounts in u are given with.
+func (u Unit) Decimals() int {
+	return definitions[u].decimals
+}
+
+func (u Unit) scale() float64 {
+	return math.Pow(10, float64(u.Decimals()))
+}
+
+// FromML converts whole milliliters to u, rounded to its precision.
+func (u Unit) FromML(ml int) float64 {
+	d := definitions[u]
+	scale := u.scale()
+	return math.Round(float64(ml)/d.milliliters*scale) / scale
+}
+
+// ToML converts an amount in u to whole milliliters. Amounts with more
+// decimal places than u allows are rejected, so that FromML(ToML(x)) == x.
+func (u Unit) ToML(amount float64) (int, error) {
+	d := definitions[u]
+	scaled := amount * u.scale()
+	steps := math.Round(scaled)
+	if math.Abs(scaled-steps) > 1e-6 {
+		return 0, ErrTooPrecise
+	}
+	return int(math.Round(steps / u.scale() * d.milliliters)), nil
+}
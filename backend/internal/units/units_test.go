@@ -0,0 +1,71 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, name := range []string{"ml", "fl_oz_us", "fl_oz_uk", "cup_us"} {
+		if u, err := Parse(name); err != nil || string(u) != name {
+			t.Errorf("Parse(%q) = %q, %v", name, u, err)
+		}
+	}
+	for _, name := range []string{"", "oz", "ML", "liter"} {
+		if _, err := Parse(name); err == nil {
+			t.Errorf("Parse(%q) accepted an unknown unit", name)
+		}
+	}
+}
+
+func TestToML(t *testing.T) {
+	tests := []struct {
+		unit   Unit
+		amount float64
+		want   int
+	}{
+		{Milliliter, 250, 250},
+		{FluidOunceUS, 8, 237},
+		{FluidOunceUS, 16.9, 500},
+		{FluidOunceUK, 10, 284},
+		{CupUS, 1, 237},
+		{CupUS, 0.25, 59},
+	}
+	for _, tt := range tests {
+		got, err := tt.unit.ToML(tt.amount)
+		if err != nil || got != tt.want {
+			t.Errorf("%s.ToML(%v) = %d, %v; want %d", tt.unit, tt.amount, got, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		unit   Unit
+		amount float64
+	}{
+		{Milliliter, 250.5},
+		{FluidOunceUS, 8.25},
+		{CupUS, 1.125},
+	} {
+		if _, err := tt.unit.ToML(tt.amount); err != ErrTooPrecise {
+			t.Errorf("%s.ToML(%v) error = %v, want ErrTooPrecise", tt.unit, tt.amount, err)
+		}
+	}
+}
+
+// Every amount a user can enter must come back unchanged after being stored
+// in milliliters.
+func TestRoundTrip(t *testing.T) {
+	for u := range definitions {
+		scale := u.scale()
+		for steps := 1; steps <= 20000; steps++ {
+			amount := float64(steps) / scale
+			ml, err := u.ToML(amount)
+			if err != nil {
+				t.Fatalf("%s.ToML(%v) error: %v", u, amount, err)
+			}
+			if got := u.FromML(ml); math.Abs(got-amount) > 1e-9 {
+				t.Fatalf("%s: %v -> %d ml -> %v", u, amount, ml, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"hydration-tracking/services/auth/internal/mail"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required" example:"password123"`
+}
+
+type DeleteAccountResponse struct {
+	Message string    `json:"message" example:"Account scheduled for deletion"`
+	PurgeAt time.Time `json:"purge_at" example:"2024-02-14T10:30:00Z"`
+}
+
+type RestoreAccountRequest struct {
+	Username string `json:"username" binding:"required" example:"john_doe"`
+	Password string `json:"password" binding:"required" example:"password123"`
+}
+
+var (
+	// accountDeletionGrace is how long a deleted account can still be restored.
+	accountDeletionGrace = 30 * 24 * time.Hour
+	accountPurgeInterval = time.Hour
+)
+
+func initAccountDeletion() {
+	accountDeletionGrace = getEnvDuration("ACCOUNT_DELETION_GRACE", accountDeletionGrace)
+	accountPurgeInterval = getEnvDuration("ACCOUNT_PURGE_INTERVAL", accountPurgeInterval)
+}
+
+// createAccountDeletionSchema adds the soft-delete marker and purge_user(),
+// which removes a user together with every row referencing it. Tables owned
+// by other services are found through their foreign keys, so per-user data
+// added later is purged as long as it references users(id).
+func createAccountDeletionSchema() error {
+	_, err := db.Exec(`
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+	CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+	CREATE OR REPLACE FUNCTION purge_user(uid UUID) RETURNS void AS $$
+	DECLARE
+		ref RECORD;
+	BEGIN
+		-- ON DELETE CASCADE references go away with the user; delete the rest explicitly
+		FOR ref IN
+			SELECT c.conrelid::regclass AS tbl, a.attname AS col
+			FROM pg_constraint c
+			JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = c.conkey[1]
+			WHERE c.contype = 'f' AND c.confrelid = 'users'::regclass AND c.confdeltype <> 'c'
+		LOOP
+			EXECUTE format('DELETE FROM %s WHERE %I = $1', ref.tbl, ref.col) USING uid;
+		END LOOP;
+		DELETE FROM users WHERE id = uid;
+	END;
+	$$ LANGUAGE plpgsql;`)
+	return err
+}
+
+// purgeDeletedAccounts permanently removes accounts whose grace period is over.
+func purgeDeletedAccounts() (int64, error) {
+	result, err := db.Exec(`SELECT purge_user(id) FROM users
+		WHERE deleted_at < CURRENT_TIMESTAMP - make_interval(secs => $1)`, int(accountDeletionGrace.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// runAccountPurger purges expired accounts every accountPurgeInterval until ctx is done.
+func runAccountPurger(ctx context.Context) {
+	ticker := time.NewTicker(accountPurgeInterval)
+	defer ticker.Stop()
+	for {
+		n, err := purgeDeletedAccounts()
+		if err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d deleted accounts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeleteAccount godoc
+// @Summary      Delete account / Удалить аккаунт
+// @Description  Schedule the account and all of its data for deletion after confirming the password. Every session is revoked; the account can be restored until purge_at / Удалить аккаунт и все данные после подтверждения пароля
+// @Tags         account
+// @Accept       json
+// @Produce      json
+// @Param        data  body  DeleteAccountRequest  true  "Current password / Текущий пароль"
+// @Security     BearerAuth
+// @Success      202   {object}  DeleteAccountResponse
+// @Failure      400,401,429,500   {object}  ErrorResponse
+// @Router       /api/v1/account [delete]
+func deleteAccount(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := confirmPassword(c, userID, req.Password)
+	if !ok {
+		return
+	}
+
+	var purgeAt time.Time
+	err := db.QueryRow(`UPDATE users SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1
+		RETURNING deleted_at + make_interval(secs => $2)`, userID, int(accountDeletionGrace.Seconds())).Scan(&purgeAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete account"})
+		return
+	}
+
+	if err := revokeAllSessions(userID); err != nil {
+		log.Printf("Failed to revoke sessions of deleted user %s: %v", userID, err)
+	}
+
+	sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "Your Hydration Tracker account will be deleted",
+		Body: fmt.Sprintf("Your Hydration Tracker account and all of its data will be permanently deleted on %s.\n\n"+
+			"Changed your mind? Restore the account before then with your username and password.\n",
+			purgeAt.UTC().Format("2006-01-02 15:04 MST")),
+	})
+
+	c.JSON(http.StatusAccepted, DeleteAccountResponse{Message: "Account scheduled for deletion", PurgeAt: purgeAt})
+}
+
+// RestoreAccount godoc
+// @Summary      Restore account / Восстановить аккаунт
+// @Description  Cancel a pending account deletion with the account credentials / Отменить удаление аккаунта
+// @Tags         account
+// @Accept       json
+// @Produce      json
+// @Param        data  body  RestoreAccountRequest  true  "Credentials / Учётные данные"
+// @Success      200   {object}  MessageResponse
+// @Failure      400,401,429,500   {object}  ErrorResponse
+// @Router       /api/v1/account/restore [post]
+func restoreAccount(c *gin.Context) {
+	var req RestoreAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if loginThrottled(c, req.Username) {
+		return
+	}
+
+	var userID, hashedPassword string
+	err := db.QueryRow("SELECT id, password FROM users WHERE username = $1 AND deleted_at IS NOT NULL", req.Username).
+		Scan(&userID, &hashedPassword)
+	if err != nil || !checkPassword(req.Password, hashedPassword) {
+		recordLoginFailure(c, req.Username)
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid credentials"})
+		return
+	}
+
+	if _, err := db.Exec("UPDATE users SET deleted_at = NULL WHERE id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to restore account"})
+		return
+	}
+
+	recordLoginSuccess(c, req.Username)
+	c.JSON(http.StatusOK, MessageResponse{Message: "Account restored, you can log in again"})
+}
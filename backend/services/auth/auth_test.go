@@ -2,13 +2,23 @@ package auth
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
+
+	"hydration-tracking/internal/jwks"
+	"hydration-tracking/services/auth/internal"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,22 +39,43 @@ func (m *mockDB) Exec(query string, args ...interface{}) (sql.Result, error) {
 }
 
 func (m *mockDB) QueryRow(query string, args ...interface{}) *sql.Row {
-	// Mock implementation for SELECT
-	// For login tests, we need to return different results based on the query
-	if len(args) > 0 {
-		username, ok := args[0].(string)
-		if ok {
-			// Check if user exists in our mock data
-			if username == "logintest" {
-				// Return a mock row with test data
-				return &sql.Row{}
-			}
-		}
-	}
-	// Return empty row for non-existent users
-	return &sql.Row{}
+	// Mock implementation for SELECT: no user exists, so lookups fail with sql.ErrNoRows
+	return noRowsDB.QueryRow(query, args...)
 }
 
+// noRowsDriver answers every query with an empty result. A zero sql.Row
+// can't be scanned, so the mock hands out rows from this driver instead.
+type noRowsDriver struct{}
+
+func (noRowsDriver) Open(string) (driver.Conn, error) { return noRowsConn{}, nil }
+
+type noRowsConn struct{}
+
+func (noRowsConn) Prepare(string) (driver.Stmt, error) { return noRowsStmt{}, nil }
+func (noRowsConn) Close() error                        { return nil }
+func (noRowsConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type noRowsStmt struct{}
+
+func (noRowsStmt) Close() error                               { return nil }
+func (noRowsStmt) NumInput() int                              { return -1 }
+func (noRowsStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (noRowsStmt) Query([]driver.Value) (driver.Rows, error)  { return noRows{}, nil }
+
+type noRows struct{}
+
+func (noRows) Columns() []string         { return nil }
+func (noRows) Close() error              { return nil }
+func (noRows) Next([]driver.Value) error { return io.EOF }
+
+var noRowsDB = func() *sql.DB {
+	sql.Register("norows", noRowsDriver{})
+	db, _ := sql.Open("norows", "")
+	return db
+}()
+
 type mockResult struct{}
 
 func (m *mockResult) LastInsertId() (int64, error) { return 1, nil }
@@ -63,6 +94,13 @@ func setupTestRouter() *gin.Engine {
 	{
 		api.POST("/register", register)
 		api.POST("/login", login)
+		api.POST("/login/mfa", loginMFA)
+		api.POST("/refresh", refresh)
+		api.POST("/password/forgot", forgotPassword)
+		api.POST("/password/reset", resetPassword)
+		api.POST("/email/verify", verifyEmail)
+		api.POST("/email/resend", resendVerification)
+		api.POST("/account/restore", restoreAccount)
 
 		protected := api.Group("/")
 		protected.Use(authMiddleware())
@@ -75,6 +113,19 @@ func setupTestRouter() *gin.Engine {
 					"username": username,
 				})
 			})
+			protected.PATCH("/profile", updateProfile)
+			protected.PUT("/profile/password", changePassword)
+			protected.POST("/logout", logout)
+			protected.POST("/logout/all", logoutAll)
+			protected.POST("/2fa/enroll", requireVerifiedEmail(), enrollTOTP)
+			protected.POST("/2fa/disable", disableTOTP)
+			protected.DELETE("/account", deleteAccount)
+		}
+
+		admin := api.Group("/admin")
+		admin.Use(adminMiddleware())
+		{
+			admin.POST("/unlock", unlockLogin)
 		}
 	}
 
@@ -85,6 +136,11 @@ func init() {
 	// Skip database initialization for tests
 	if testing.Testing() {
 		db = newMockDB()
+		key, err := internal.GenerateEd25519Key("test-key")
+		if err != nil {
+			panic(err)
+		}
+		signingKeys = internal.NewKeyRing(key)
 	}
 }
 
@@ -202,27 +258,312 @@ func TestAuthMiddleware(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
 
+func TestRefreshValidation(t *testing.T) {
+	r := setupTestRouter()
+
+	req, _ := http.NewRequest("POST", "/api/v1/refresh", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTokenFlowValidation(t *testing.T) {
+	r := setupTestRouter()
+
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"Forgot with invalid email", "/api/v1/password/forgot", `{"email":"not-an-email"}`},
+		{"Reset without token", "/api/v1/password/reset", `{"new_password":"password123"}`},
+		{"Reset with short password", "/api/v1/password/reset", `{"token":"abc","new_password":"123"}`},
+		{"Verify without token", "/api/v1/email/verify", `{}`},
+		{"Resend with invalid email", "/api/v1/email/resend", `{"email":"not-an-email"}`},
+		{"MFA login without token", "/api/v1/login/mfa", `{"code":"123456"}`},
+		{"MFA login without code", "/api/v1/login/mfa", `{"mfa_token":"abc"}`},
+		{"MFA login with code and recovery code", "/api/v1/login/mfa", `{"mfa_token":"abc","code":"123456","recovery_code":"abcde-fghjk"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestLogoutRequiresToken(t *testing.T) {
+	r := setupTestRouter()
+
+	for _, path := range []string{"/api/v1/logout", "/api/v1/logout/all"} {
+		req, _ := http.NewRequest("POST", path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+	}
+}
+
+func TestRevokedTokenRejected(t *testing.T) {
+	r := setupTestRouter()
+	token := generateToken(User{ID: "revoked-user", Username: "revoked"}, "")
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	assert.NoError(t, err)
+	jti := parsed.Claims.(*Claims).ID
+	assert.NotEmpty(t, jti)
+
+	req, _ := http.NewRequest("GET", "/api/v1/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.NoError(t, revoked.RevokeToken(context.Background(), jti, time.Minute))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestJWKSPublishesSigningKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/.well-known/jwks.json", jwksHandler)
+
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var set jwks.Set
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	assert.Len(t, set.Keys, 1)
+	assert.Equal(t, "test-key", set.Keys[0].Kid)
+	assert.Equal(t, "EdDSA", set.Keys[0].Alg)
+
+	// Tokens must carry the kid so verifiers can pick the key
+	parsed, _, err := jwt.NewParser().ParseUnverified(generateToken(User{ID: "user", Username: "name"}, ""), &Claims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "test-key", parsed.Header["kid"])
+}
+
+func TestGenerateTokenLimitsUnverifiedUsers(t *testing.T) {
+	defer func(policy string) { verificationPolicy = policy }(verificationPolicy)
+
+	claimsFor := func(user User) *Claims {
+		parsed, _, err := jwt.NewParser().ParseUnverified(generateToken(user, ""), &Claims{})
+		assert.NoError(t, err)
+		return parsed.Claims.(*Claims)
+	}
+
+	verificationPolicy = verificationLimit
+	assert.True(t, claimsFor(User{ID: "u1", Username: "new"}).Unverified)
+	assert.False(t, claimsFor(User{ID: "u1", Username: "new", EmailVerified: true}).Unverified)
+
+	verificationPolicy = verificationOff
+	assert.False(t, claimsFor(User{ID: "u1", Username: "new"}).Unverified)
+}
+
+func TestMFAChallengeIsNotAnAccessToken(t *testing.T) {
+	r := setupTestRouter()
+
+	challenge, err := generateMFAChallenge(User{ID: "mfa-user", Username: "mfa"})
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/api/v1/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+challenge)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTwoFactorEnrollmentRequiresVerifiedEmail(t *testing.T) {
+	defer func(policy string) { verificationPolicy = policy }(verificationPolicy)
+	verificationPolicy = verificationLimit
+	r := setupTestRouter()
+
+	req, _ := http.NewRequest("POST", "/api/v1/2fa/enroll", nil)
+	req.Header.Set("Authorization", "Bearer "+generateToken(User{ID: "u1", Username: "new"}, ""))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
 func TestGenerateToken(t *testing.T) {
 	userID := "test-user-id"
 	username := "testuser"
 
-	token := generateToken(userID, username)
+	token := generateToken(User{ID: userID, Username: username}, "test-session-id")
 	assert.NotEmpty(t, token)
 	assert.Greater(t, len(token), 10) // Basic length check
 }
 
 func TestHashPassword(t *testing.T) {
 	password := "testpassword"
-	hashed := hashPassword(password)
+	hashed, err := hashPassword(password)
 
-	// In this simplified implementation, password is not actually hashed
-	assert.Equal(t, password, hashed)
+	assert.NoError(t, err)
+	assert.NotEqual(t, password, hashed)
+	assert.Contains(t, hashed, "$argon2id$")
 }
 
 func TestCheckPassword(t *testing.T) {
 	password := "testpassword"
-	hashed := hashPassword(password)
+	hashed, _ := hashPassword(password)
 
 	assert.True(t, checkPassword(password, hashed))
 	assert.False(t, checkPassword("wrongpassword", hashed))
+
+	// Rows stored before hashing was introduced still verify
+	assert.True(t, checkPassword(password, password))
+}
+
+func TestLoginLockout(t *testing.T) {
+	defer func(token string) { adminToken = token }(adminToken)
+	adminToken = "test-admin-token"
+	r := setupTestRouter()
+
+	for i := 0; i < accountPolicy.LockoutThreshold; i++ {
+		_, err := accountAttempts.Fail(context.Background(), "locked-user")
+		assert.NoError(t, err)
+	}
+
+	body := `{"username":"locked-user","password":"password123"}`
+	req, _ := http.NewRequest("POST", "/api/v1/login", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, strconv.Itoa(int(accountPolicy.LockoutDuration.Seconds())), w.Header().Get("Retry-After"))
+
+	// Unlocking requires the admin token
+	unlock := func(token string) int {
+		req, _ := http.NewRequest("POST", "/api/v1/admin/unlock", bytes.NewBufferString(`{"username":"locked-user"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Admin-Token", token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusForbidden, unlock("wrong-token"))
+	assert.Equal(t, http.StatusOK, unlock("test-admin-token"))
+
+	wait, err := accountAttempts.RetryAfter(context.Background(), "locked-user")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestAdminDisabledWithoutToken(t *testing.T) {
+	defer func(token string) { adminToken = token }(adminToken)
+	adminToken = ""
+	r := setupTestRouter()
+
+	req, _ := http.NewRequest("POST", "/api/v1/admin/unlock", bytes.NewBufferString(`{"username":"john"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestProfileUpdateValidation(t *testing.T) {
+	r := setupTestRouter()
+	token := generateToken(User{ID: "u1", Username: "john_doe", EmailVerified: true}, "")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"empty update", "PATCH", "/api/v1/profile", `{}`},
+		{"short username", "PATCH", "/api/v1/profile", `{"username":"jo"}`},
+		{"invalid email", "PATCH", "/api/v1/profile", `{"email":"not-an-email"}`},
+		{"unknown timezone", "PATCH", "/api/v1/profile", `{"timezone":"Mars/Olympus_Mons"}`},
+		{"server-local timezone", "PATCH", "/api/v1/profile", `{"timezone":"Local"}`},
+		{"unknown unit", "PATCH", "/api/v1/profile", `{"unit":"liter"}`},
+		{"missing current password", "PUT", "/api/v1/profile/password", `{"new_password":"newpassword456"}`},
+		{"short new password", "PUT", "/api/v1/profile/password", `{"current_password":"password123","new_password":"123"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestAccountDeletionValidation(t *testing.T) {
+	r := setupTestRouter()
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/account", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req.Header.Set("Authorization", "Bearer "+generateToken(User{ID: "u1", Username: "john_doe"}, ""))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req, _ = http.NewRequest("POST", "/api/v1/account/restore", bytes.NewBufferString(`{"username":"john_doe"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDisableTOTPCountsFailedPasswords(t *testing.T) {
+	r := setupTestRouter()
+	user := User{ID: "2fa-user", Username: "2fa-guesser", EmailVerified: true}
+	defer func() {
+		_ = accountAttempts.Reset(context.Background(), user.Username)
+		_ = ipAttempts.Reset(context.Background(), "")
+	}()
+	token := generateToken(user, "")
+
+	status := 0
+	for i := 0; i <= accountPolicy.FreeAttempts+1 && status != http.StatusTooManyRequests; i++ {
+		req, _ := http.NewRequest("POST", "/api/v1/2fa/disable", bytes.NewBufferString(`{"password":"guess"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		status = w.Code
+		if i < accountPolicy.FreeAttempts {
+			assert.Equal(t, http.StatusUnauthorized, status)
+		}
+	}
+	assert.Equal(t, http.StatusTooManyRequests, status)
+}
+
+func TestLoginIPLimitIgnoresForwardedFor(t *testing.T) {
+	r := setupTestRouter()
+	assert.NoError(t, setTrustedProxies(r))
+	const clientIP = "192.0.2.1"
+	defer func() { _ = ipAttempts.Reset(context.Background(), clientIP) }()
+
+	// Every attempt claims another address and targets another account, so
+	// only the per-IP counter of the real peer can stop them
+	status := 0
+	for i := 0; i <= ipPolicy.FreeAttempts+1 && status != http.StatusTooManyRequests; i++ {
+		body := `{"username":"sprayed-` + strconv.Itoa(i) + `","password":"password123"}`
+		req := httptest.NewRequest("POST", "/api/v1/login", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "198.51.100."+strconv.Itoa(i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		status = w.Code
+	}
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	for i := 0; i <= ipPolicy.FreeAttempts+1; i++ {
+		_ = accountAttempts.Reset(context.Background(), "sprayed-"+strconv.Itoa(i))
+	}
 }
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"hydration-tracking/internal/jwks"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a private key with the kid it is published under.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    crypto.Signer
+}
+
+// KeyRing signs tokens with its active key and verifies tokens signed by any
+// key it holds, so a new key can be introduced before the old one is retired.
+type KeyRing struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+func NewKeyRing(active *SigningKey, others ...*SigningKey) *KeyRing {
+	ring := &KeyRing{active: active, keys: map[string]*SigningKey{active.ID: active}}
+	for _, k := range others {
+		ring.keys[k.ID] = k
+	}
+	return ring
+}
+
+func GenerateEd25519Key(id string) (*SigningKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Key: priv}, nil
+}
+
+// ParseSigningKey reads a PEM encoded PKCS#8 (RSA or Ed25519) or PKCS#1 (RSA) private key.
+func ParseSigningKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM block found", id)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", id)
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, Key: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Key: key}, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", id, parsed)
+	}
+}
+
+// LoadKeyRing loads every *.pem file in dir, using the file name as kid.
+// activeID selects the signing key; when empty the last kid in lexical
+// order is used, so date-named files (2024-06-01.pem) rotate by adding a file.
+func LoadKeyRing(dir, activeID string) (*KeyRing, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.pem keys found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	var keys []*SigningKey
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseSigningKey(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	active := keys[len(keys)-1]
+	if activeID != "" {
+		active = nil
+		for _, k := range keys {
+			if k.ID == activeID {
+				active = k
+			}
+		}
+		if active == nil {
+			return nil, fmt.Errorf("active key %s not found in %s", activeID, dir)
+		}
+	}
+	return NewKeyRing(active, keys...), nil
+}
+
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.active.Method, claims)
+	token.Header["kid"] = r.active.ID
+	return token.SignedString(r.active.Key)
+}
+
+// Keyfunc resolves the public key for a token signed by one of the ring's keys.
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := r.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.Key.Public(), nil
+}
+
+// JWKS returns the public half of every key in the ring.
+func (r *KeyRing) JWKS() (jwks.Set, error) {
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := jwks.Set{Keys: make([]jwks.JWK, 0, len(ids))}
+	for _, id := range ids {
+		jwk, err := jwks.FromPublicKey(id, r.keys[id].Key.Public())
+		if err != nil {
+			return jwks.Set{}, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeRSAKey(t *testing.T, dir, name string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadKeyRingRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2024-01-01.pem")
+
+	old, err := LoadKeyRing(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeyRing() error: %v", err)
+	}
+	oldToken, err := old.Sign(jwt.RegisteredClaims{Subject: "user"})
+	if err != nil {
+		t.Fatalf("Sign() error: %v", err)
+	}
+
+	// Adding a newer key makes it active while tokens from the old one still verify.
+	writeRSAKey(t, dir, "2024-06-01.pem")
+	rotated, err := LoadKeyRing(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeyRing() error: %v", err)
+	}
+	newToken, _ := rotated.Sign(jwt.RegisteredClaims{Subject: "user"})
+
+	parsed, err := jwt.Parse(newToken, rotated.Keyfunc)
+	if err != nil {
+		t.Fatalf("Parse(new) error: %v", err)
+	}
+	if kid := parsed.Header["kid"]; kid != "2024-06-01" {
+		t.Errorf("kid = %v, want 2024-06-01", kid)
+	}
+	if parsed.Method.Alg() != "RS256" {
+		t.Errorf("alg = %v, want RS256", parsed.Method.Alg())
+	}
+	if _, err := jwt.Parse(oldToken, rotated.Keyfunc); err != nil {
+		t.Errorf("Parse(old) error: %v", err)
+	}
+
+	set, err := rotated.JWKS()
+	if err != nil {
+		t.Fatalf("JWKS() error: %v", err)
+	}
+	if len(set.Keys) != 2 || set.Keys[0].Kid != "2024-01-01" || set.Keys[1].Kid != "2024-06-01" {
+		t.Errorf("JWKS() = %+v", set)
+	}
+
+	if _, err := LoadKeyRing(dir, "missing"); err == nil {
+		t.Error("LoadKeyRing() accepted an unknown active kid")
+	}
+}
+
+func TestKeyRingRejectsForeignTokens(t *testing.T) {
+	ring := testKeyRing(t)
+
+	other, _ := GenerateEd25519Key("test-key")
+	forged, _ := NewKeyRing(other).Sign(jwt.RegisteredClaims{Subject: "user"})
+	if _, err := jwt.Parse(forged, ring.Keyfunc); err == nil {
+		t.Error("Parse() accepted a token signed by another key with the same kid")
+	}
+
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "user"})
+	hs.Header["kid"] = "test-key"
+	signed, _ := hs.SignedString([]byte("secret"))
+	if _, err := jwt.Parse(signed, ring.Keyfunc); err == nil {
+		t.Error("Parse() accepted an HS256 token")
+	}
+}
@@ -0,0 +1,124 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         30 * time.Second,
+	LockoutThreshold: 10,
+	LockoutDuration:  30 * time.Minute,
+	Window:           time.Hour,
+}
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{8, 16 * time.Second},
+		{9, 30 * time.Second},
+		{10, 30 * time.Minute},
+		{25, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := testPolicy.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	store := NewMemoryStore()
+	store.now = clock
+	accounts := NewLimiter(store, "account", testPolicy)
+	accounts.now = clock
+	ips := NewLimiter(store, "ip", testPolicy)
+	ips.now = clock
+
+	for i := 0; i < 3; i++ {
+		if delay, _ := accounts.Fail(ctx, "john"); delay != 0 {
+			t.Fatalf("Fail() #%d delay = %v, want 0", i+1, delay)
+		}
+	}
+	if wait, _ := accounts.RetryAfter(ctx, "john"); wait != 0 {
+		t.Errorf("RetryAfter() = %v within free attempts", wait)
+	}
+
+	if delay, _ := accounts.Fail(ctx, "john"); delay != time.Second {
+		t.Errorf("Fail() delay = %v, want 1s", delay)
+	}
+	if wait, _ := accounts.RetryAfter(ctx, "john"); wait != time.Second {
+		t.Errorf("RetryAfter() = %v, want 1s", wait)
+	}
+	// Namespaces don't share counters
+	if wait, _ := ips.RetryAfter(ctx, "john"); wait != 0 {
+		t.Errorf("ip RetryAfter() = %v, want 0", wait)
+	}
+
+	now = now.Add(2 * time.Second)
+	if wait, _ := accounts.RetryAfter(ctx, "john"); wait != 0 {
+		t.Errorf("RetryAfter() = %v after the delay passed", wait)
+	}
+
+	for i := 0; i < 6; i++ {
+		_, _ = accounts.Fail(ctx, "john")
+	}
+	if wait, _ := accounts.RetryAfter(ctx, "john"); wait != 30*time.Minute {
+		t.Errorf("RetryAfter() = %v, want lockout of 30m", wait)
+	}
+
+	if err := accounts.Reset(ctx, "john"); err != nil {
+		t.Fatalf("Reset() error: %v", err)
+	}
+	if wait, _ := accounts.RetryAfter(ctx, "john"); wait != 0 {
+		t.Errorf("RetryAfter() = %v after Reset", wait)
+	}
+}
+
+func TestMemoryStoreWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	_, _ = store.Increment(ctx, "k", time.Minute)
+	_, _ = store.Increment(ctx, "k", time.Minute)
+	now = now.Add(2 * time.Minute)
+	if n, _ := store.Increment(ctx, "k", time.Minute); n != 1 {
+		t.Errorf("Increment() = %d after the window, want 1", n)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	_, _ = store.Increment(ctx, "expired", time.Minute)
+	_, _ = store.Increment(ctx, "locked", time.Minute)
+	_ = store.Lock(ctx, "locked", now.Add(time.Hour))
+	now = now.Add(2 * time.Minute)
+	_, _ = store.Increment(ctx, "new", time.Minute)
+
+	if _, ok := store.entries["expired"]; ok {
+		t.Error("expired entry was not swept")
+	}
+	if _, ok := store.entries["locked"]; !ok {
+		t.Error("locked entry was swept")
+	}
+}
@@ -0,0 +1,103 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	failures    int
+	expiresAt   time.Time
+	lockedUntil time.Time
+}
+
+// MemoryStore keeps counters in process memory; use RedisStore when several
+// auth instances run behind a load balancer. Expired entries are swept
+// periodically, so keys that are never looked up again don't pile up.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry), now: time.Now}
+}
+
+// entry returns the live entry for key, dropping it when both the counter
+// and the lock have expired. Callers hold s.mu.
+func (s *MemoryStore) entry(key string, now time.Time) *memoryEntry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(e.expiresAt) {
+		e.failures = 0
+		if !now.Before(e.lockedUntil) {
+			delete(s.entries, key)
+			return nil
+		}
+	}
+	return e
+}
+
+// sweep drops expired entries at most once a minute. Callers hold s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(time.Minute)
+	for key, e := range s.entries {
+		if !now.Before(e.expiresAt) && !now.Before(e.lockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *MemoryStore) Increment(_ context.Context, key string, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	e := s.entry(key, now)
+	if e == nil {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+	e.failures++
+	e.expiresAt = now.Add(ttl)
+	return e.failures, nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	e := s.entry(key, now)
+	if e == nil {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+	e.lockedUntil = until
+	return nil
+}
+
+func (s *MemoryStore) Status(_ context.Context, key string) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entry(key, s.now())
+	if e == nil {
+		return 0, time.Time{}, nil
+	}
+	return e.failures, e.lockedUntil, nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
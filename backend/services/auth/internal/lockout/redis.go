@@ -0,0 +1,62 @@
+package lockout
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore shares counters between auth instances.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func failuresKey(key string) string { return "lockout:failures:" + key }
+func lockKey(key string) string     { return "lockout:lock:" + key }
+
+func (s *RedisStore) Increment(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, failuresKey(key))
+	pipe.PExpire(ctx, failuresKey(key), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+func (s *RedisStore) Lock(ctx context.Context, key string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, lockKey(key), until.UnixMilli(), ttl).Err()
+}
+
+func (s *RedisStore) Status(ctx context.Context, key string) (int, time.Time, error) {
+	values, err := s.client.MGet(ctx, failuresKey(key), lockKey(key)).Result()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var failures int
+	var lockedUntil time.Time
+	if raw, ok := values[0].(string); ok {
+		failures, _ = strconv.Atoi(raw)
+	}
+	if raw, ok := values[1].(string); ok {
+		if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			lockedUntil = time.UnixMilli(ms)
+		}
+	}
+	return failures, lockedUntil, nil
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, failuresKey(key), lockKey(key)).Err()
+}
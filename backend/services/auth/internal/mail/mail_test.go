@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+	err := m.Send(context.Background(), Message{To: "john@example.com", Subject: "Hello", Body: "line 1\nline 2"})
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("found %d .eml files, want 1", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	for _, want := range []string{"From: no-reply@example.com\r\n", "To: john@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline 1\r\nline 2"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message does not contain %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("MAIL_DRIVER", "file")
+	t.Setenv("MAIL_DIR", "/tmp/mail")
+	m, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv() error: %v", err)
+	}
+	if fm, ok := m.(*FileMailer); !ok || fm.Dir != "/tmp/mail" {
+		t.Errorf("FromEnv() = %#v, want FileMailer in /tmp/mail", m)
+	}
+
+	t.Setenv("MAIL_DRIVER", "smtp")
+	if _, err := FromEnv(); err == nil {
+		t.Error("FromEnv() accepted smtp without SMTP_HOST")
+	}
+
+	t.Setenv("MAIL_DRIVER", "pigeon")
+	if _, err := FromEnv(); err == nil {
+		t.Error("FromEnv() accepted an unknown driver")
+	}
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidHash = errors.New("invalid password hash")
+	// ErrPasswordTooLong is returned by hashers with an input limit (bcrypt
+	// uses at most 72 bytes); any other Hash error is an internal failure.
+	ErrPasswordTooLong = errors.New("password is too long")
+)
+
+// PasswordHasher produces self-describing hashes: every parameter needed to
+// verify a password (cost, salt, memory...) is encoded in the stored string.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// Handles reports whether encoded was produced by this scheme.
+	Handles(encoded string) bool
+	// NeedsRehash reports whether encoded uses weaker parameters than the hasher.
+	NeedsRehash(encoded string) bool
+}
+
+// BcryptHasher stores hashes in the standard $2a$<cost>$... format.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", ErrPasswordTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h BcryptHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return true
+	}
+	return cost < h.Cost
+}
+
+// Argon2idHasher stores hashes in the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<threads>$<salt>$<key>
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+const argon2idPrefix = "$argon2id$"
+
+// DefaultArgon2id follows the OWASP baseline of 64 MiB memory and 3 passes.
+func DefaultArgon2id() Argon2idHasher {
+	return Argon2idHasher{Time: 3, Memory: 64 * 1024, Threads: 2, KeyLen: 32, SaltLen: 16}
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (h Argon2idHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory < h.Memory ||
+		params.Time < h.Time ||
+		params.Threads < h.Threads ||
+		uint32(len(key)) < h.KeyLen
+}
+
+func decodeArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+	parts := strings.Split(encoded, "$")
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+	params.SaltLen = uint32(len(salt))
+	params.KeyLen = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// PasswordManager hashes new passwords with Preferred and verifies stored
+// hashes produced by any known scheme, including legacy plaintext rows.
+type PasswordManager struct {
+	Preferred PasswordHasher
+	Accepted  []PasswordHasher
+}
+
+func NewPasswordManager(preferred PasswordHasher) *PasswordManager {
+	return &PasswordManager{
+		Preferred: preferred,
+		Accepted:  []PasswordHasher{BcryptHasher{Cost: bcrypt.DefaultCost}, DefaultArgon2id()},
+	}
+}
+
+func (m *PasswordManager) Hash(password string) (string, error) {
+	return m.Preferred.Hash(password)
+}
+
+// Verify checks password against encoded. rehash is true when the password
+// matched but encoded should be replaced with a fresh Hash: it is plaintext,
+// uses a non-preferred scheme, or uses weaker parameters.
+func (m *PasswordManager) Verify(password, encoded string) (ok bool, rehash bool, err error) {
+	if m.Preferred.Handles(encoded) {
+		ok, err = m.Preferred.Verify(password, encoded)
+		return ok, ok && m.Preferred.NeedsRehash(encoded), err
+	}
+	for _, h := range m.Accepted {
+		if h.Handles(encoded) {
+			ok, err = h.Verify(password, encoded)
+			return ok, ok, err
+		}
+	}
+
+	// Legacy rows were stored as plaintext before hashing was introduced.
+	ok = subtle.ConstantTimeCompare([]byte(password), []byte(encoded)) == 1
+	return ok, ok, nil
+}
+
+var defaultPasswords = NewPasswordManager(DefaultArgon2id())
+
+func HashPassword(password string) (string, error) {
+	return defaultPasswords.Hash(password)
+}
+
+func CheckPassword(password, hashedPassword string) bool {
+	ok, _, err := defaultPasswords.Verify(password, hashedPassword)
+	return err == nil && ok
+}
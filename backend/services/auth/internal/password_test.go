@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+// Cheap parameters keep the tests fast; production values come from the environment.
+var (
+	testArgon2 = Argon2idHasher{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLen: 32, SaltLen: 16}
+	testBcrypt = BcryptHasher{Cost: 4}
+)
+
+func TestArgon2idHasher(t *testing.T) {
+	hashed, err := testArgon2.Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash() error: %v", err)
+	}
+	if !strings.HasPrefix(hashed, "$argon2id$v=19$m=8192,t=1,p=1$") {
+		t.Errorf("Hash() = %v, want encoded parameters", hashed)
+	}
+	if ok, err := testArgon2.Verify("secret", hashed); err != nil || !ok {
+		t.Errorf("Verify() = %v, %v; want true, nil", ok, err)
+	}
+	if ok, _ := testArgon2.Verify("wrong", hashed); ok {
+		t.Error("Verify() = true for wrong password")
+	}
+	if _, err := testArgon2.Verify("secret", "$argon2id$garbage"); err == nil {
+		t.Error("Verify() accepted a malformed hash")
+	}
+
+	stronger := testArgon2
+	stronger.Memory = 16 * 1024
+	if testArgon2.NeedsRehash(hashed) {
+		t.Error("NeedsRehash() = true for same parameters")
+	}
+	if !stronger.NeedsRehash(hashed) {
+		t.Error("NeedsRehash() = false for weaker memory cost")
+	}
+}
+
+func TestBcryptHasher(t *testing.T) {
+	hashed, err := testBcrypt.Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash() error: %v", err)
+	}
+	if !testBcrypt.Handles(hashed) {
+		t.Errorf("Handles(%v) = false", hashed)
+	}
+	if ok, err := testBcrypt.Verify("secret", hashed); err != nil || !ok {
+		t.Errorf("Verify() = %v, %v; want true, nil", ok, err)
+	}
+	if ok, _ := testBcrypt.Verify("wrong", hashed); ok {
+		t.Error("Verify() = true for wrong password")
+	}
+	if !(BcryptHasher{Cost: 5}).NeedsRehash(hashed) {
+		t.Error("NeedsRehash() = false for lower cost")
+	}
+	if _, err := testBcrypt.Hash(strings.Repeat("x", 73)); err != ErrPasswordTooLong {
+		t.Errorf("Hash() of 73 bytes error = %v, want %v", err, ErrPasswordTooLong)
+	}
+}
+
+func TestPasswordManagerVerify(t *testing.T) {
+	m := &PasswordManager{Preferred: testArgon2, Accepted: []PasswordHasher{testBcrypt, testArgon2}}
+	bcryptHash, _ := testBcrypt.Hash("secret")
+	argonHash, _ := testArgon2.Hash("secret")
+	weakHash, _ := Argon2idHasher{Time: 1, Memory: 4 * 1024, Threads: 1, KeyLen: 32, SaltLen: 16}.Hash("secret")
+
+	tests := []struct {
+		name       string
+		password   string
+		stored     string
+		wantOK     bool
+		wantRehash bool
+	}{
+		{"preferred scheme", "secret", argonHash, true, false},
+		{"weaker preferred scheme", "secret", weakHash, true, true},
+		{"other scheme", "secret", bcryptHash, true, true},
+		{"legacy plaintext", "secret", "secret", true, true},
+		{"wrong password", "wrong", argonHash, false, false},
+		{"wrong legacy plaintext", "wrong", "secret", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := m.Verify(tt.password, tt.stored)
+			if err != nil {
+				t.Fatalf("Verify() error: %v", err)
+			}
+			if ok != tt.wantOK || rehash != tt.wantRehash {
+				t.Errorf("Verify() = %v, %v; want %v, %v", ok, rehash, tt.wantOK, tt.wantRehash)
+			}
+		})
+	}
+}
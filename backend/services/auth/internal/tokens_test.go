@@ -0,0 +1,30 @@
+package internal
+
+import "testing"
+
+func TestNewOpaqueToken(t *testing.T) {
+	t1, err := NewOpaqueToken()
+	if err != nil {
+		t.Fatalf("NewOpaqueToken() error: %v", err)
+	}
+	t2, _ := NewOpaqueToken()
+	if t1 == t2 {
+		t.Error("NewOpaqueToken() returned the same token twice")
+	}
+	if len(t1) != 43 {
+		t.Errorf("len(token) = %d, want 43", len(t1))
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	h := HashToken("token")
+	if len(h) != 64 {
+		t.Errorf("len(HashToken()) = %d, want 64", len(h))
+	}
+	if h != HashToken("token") {
+		t.Error("HashToken() is not deterministic")
+	}
+	if h == HashToken("other") {
+		t.Error("HashToken() collided for different tokens")
+	}
+}
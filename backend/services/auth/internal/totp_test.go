@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test secret, SHA1 variant.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode() error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %v, want %v", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := TOTPStep(now)
+	previous, _ := TOTPCode(rfcSecret, step-1)
+
+	if got, ok := ValidateTOTP(rfcSecret, "081804", now, 0); !ok || got != step {
+		t.Errorf("ValidateTOTP(current) = %v, %v", got, ok)
+	}
+	if _, ok := ValidateTOTP(rfcSecret, previous, now, 0); !ok {
+		t.Error("ValidateTOTP() rejected the previous step within skew")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "081804", now, step); ok {
+		t.Error("ValidateTOTP() accepted a replayed step")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "081804", now.Add(5*time.Minute), 0); ok {
+		t.Error("ValidateTOTP() accepted an expired code")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Hydration Tracker", "john_doe", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/Hydration%20Tracker:john_doe?") {
+		t.Errorf("TOTPURI() = %v", uri)
+	}
+	for _, want := range []string{"secret=ABC", "issuer=Hydration+Tracker", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("TOTPURI() = %v, missing %v", uri, want)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("NewRecoveryCodes() error: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+		if got := NormalizeRecoveryCode(" " + strings.ToUpper(strings.Replace(code, "-", "", 1)) + " "); got != code {
+			t.Errorf("NormalizeRecoveryCode() = %q, want %q", got, code)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type Claims struct {
@@ -12,27 +13,15 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func HashPassword(password string) string {
-	// В реальном проекте используйте bcrypt
-	return password
-}
-
-func CheckPassword(password, hashedPassword string) bool {
-	// В реальном проекте используйте bcrypt.CompareHashAndPassword
-	return password == hashedPassword
-}
-
-var secret = []byte("test-secret-key")
-
-func GenerateToken(userID, username string) (string, error) {
+func GenerateToken(keys *KeyRing, userID, username string) (string, error) {
 	claims := Claims{
 		UserID:   userID,
 		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secret)
+	return keys.Sign(claims)
 }
@@ -8,9 +8,12 @@ import (
 
 func TestHashPasswordAndCheckPassword(t *testing.T) {
 	password := "my-password"
-	hashed := HashPassword(password)
-	if hashed != password {
-		t.Errorf("HashPassword() = %v, want %v", hashed, password)
+	hashed, err := HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword() error: %v", err)
+	}
+	if hashed == password {
+		t.Error("HashPassword() returned the plaintext password")
 	}
 
 	if !CheckPassword(password, hashed) {
@@ -22,8 +25,17 @@ func TestHashPasswordAndCheckPassword(t *testing.T) {
 	}
 }
 
+func testKeyRing(t *testing.T) *KeyRing {
+	key, err := GenerateEd25519Key("test-key")
+	if err != nil {
+		t.Fatalf("GenerateEd25519Key() error: %v", err)
+	}
+	return NewKeyRing(key)
+}
+
 func TestGenerateToken(t *testing.T) {
-	tokenStr, err := GenerateToken("user123", "testuser")
+	keys := testKeyRing(t)
+	tokenStr, err := GenerateToken(keys, "user123", "testuser")
 	if err != nil {
 		t.Fatalf("GenerateToken() error: %v", err)
 	}
@@ -32,9 +44,7 @@ func TestGenerateToken(t *testing.T) {
 	}
 
 	// Проверим, что токен можно распарсить
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return secret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, keys.Keyfunc)
 	if err != nil {
 		t.Fatalf("jwt.ParseWithClaims() error: %v", err)
 	}
@@ -54,8 +64,9 @@ func TestGenerateToken(t *testing.T) {
 }
 
 func TestGenerateToken_UniqueTokens(t *testing.T) {
-	t1, _ := GenerateToken("user1", "u1")
-	t2, _ := GenerateToken("user2", "u2")
+	keys := testKeyRing(t)
+	t1, _ := GenerateToken(keys, "user1", "u1")
+	t2, _ := GenerateToken(keys, "user2", "u2")
 	if t1 == t2 {
 		t.Error("Tokens for different users should not be equal")
 	}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"hydration-tracking/services/auth/internal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var signingKeys *internal.KeyRing
+
+// initSigningKeys loads the RS256/EdDSA keys from JWT_KEYS_DIR. Without it a
+// throwaway key is generated, which is fine for local runs only: tokens stop
+// verifying when the process restarts.
+func initSigningKeys() {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		log.Println("Warning: JWT_KEYS_DIR not set, signing tokens with an ephemeral key")
+		key, err := internal.GenerateEd25519Key("ephemeral-" + uuid.New().String())
+		if err != nil {
+			log.Fatal(err)
+		}
+		signingKeys = internal.NewKeyRing(key)
+		return
+	}
+
+	ring, err := internal.LoadKeyRing(dir, os.Getenv("JWT_ACTIVE_KEY_ID"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	signingKeys = ring
+}
+
+// JWKS godoc
+// @Summary      Token verification keys / Ключи проверки токенов
+// @Description  Public keys used to verify access tokens (RFC 7517) / Публичные ключи для проверки токенов
+// @Tags         auth
+// @Produce      json
+// @Success      200   {object}  jwks.Set
+// @Router       /.well-known/jwks.json [get]
+func jwksHandler(c *gin.Context) {
+	set, err := signingKeys.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load keys"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"hydration-tracking/services/auth/internal/lockout"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UnlockRequest struct {
+	Username string `json:"username" example:"john_doe"`
+	IP       string `json:"ip" example:"203.0.113.7"`
+}
+
+var (
+	// Failures are counted per account (guessing one user's password) and
+	// per client IP (spraying passwords across many accounts).
+	accountPolicy = lockout.Policy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  30 * time.Minute,
+		Window:           time.Hour,
+	}
+	ipPolicy = lockout.Policy{
+		FreeAttempts:     10,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 50,
+		LockoutDuration:  time.Hour,
+		Window:           time.Hour,
+	}
+
+	accountAttempts = lockout.NewLimiter(lockout.NewMemoryStore(), "account", accountPolicy)
+	ipAttempts      = lockout.NewLimiter(lockout.NewMemoryStore(), "ip", ipPolicy)
+	adminToken      string
+)
+
+func initLockout() {
+	store, err := lockout.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	accountPolicy.LockoutThreshold = getEnvInt("LOGIN_LOCKOUT_THRESHOLD", accountPolicy.LockoutThreshold)
+	accountPolicy.LockoutDuration = getEnvDuration("LOGIN_LOCKOUT_DURATION", accountPolicy.LockoutDuration)
+	ipPolicy.LockoutThreshold = getEnvInt("LOGIN_IP_LOCKOUT_THRESHOLD", ipPolicy.LockoutThreshold)
+	ipPolicy.LockoutDuration = getEnvDuration("LOGIN_IP_LOCKOUT_DURATION", ipPolicy.LockoutDuration)
+
+	accountAttempts = lockout.NewLimiter(store, "account", accountPolicy)
+	ipAttempts = lockout.NewLimiter(store, "ip", ipPolicy)
+	adminToken = getEnv("ADMIN_TOKEN", "")
+}
+
+// loginThrottled answers 429 when the account or the client IP must still
+// wait before another attempt. Store errors fail open: an unavailable Redis
+// shouldn't lock every user out.
+// setTrustedProxies lets c.ClientIP() read X-Forwarded-For only from the
+// proxies in TRUSTED_PROXIES (comma-separated IPs or CIDRs, default none).
+// Otherwise a client could claim a new address on every attempt and never run
+// out of its per-IP budget.
+func setTrustedProxies(r *gin.Engine) error {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return r.SetTrustedProxies(proxies)
+}
+
+func loginThrottled(c *gin.Context, username string) bool {
+	ctx := c.Request.Context()
+	wait, err := accountAttempts.RetryAfter(ctx, username)
+	if err != nil {
+		log.Printf("Failed to check login attempts: %v", err)
+	}
+	ipWait, err := ipAttempts.RetryAfter(ctx, c.ClientIP())
+	if err != nil {
+		log.Printf("Failed to check login attempts: %v", err)
+	}
+	if ipWait > wait {
+		wait = ipWait
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	setRetryAfter(c, wait)
+	c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: "Too many failed login attempts, try again later"})
+	return true
+}
+
+// recordLoginFailure counts a failed attempt against the account and the
+// client IP, advertising the resulting delay in Retry-After.
+func recordLoginFailure(c *gin.Context, username string) {
+	ctx := c.Request.Context()
+	wait, err := accountAttempts.Fail(ctx, username)
+	if err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+	ipWait, err := ipAttempts.Fail(ctx, c.ClientIP())
+	if err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+	if ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		setRetryAfter(c, wait)
+	}
+}
+
+// recordLoginSuccess clears the account's failures. The IP counter is left
+// alone so an attacker can't reset it by logging into their own account.
+func recordLoginSuccess(c *gin.Context, username string) {
+	if err := accountAttempts.Reset(c.Request.Context(), username); err != nil {
+		log.Printf("Failed to reset login attempts: %v", err)
+	}
+}
+
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// adminMiddleware guards operator endpoints with the static ADMIN_TOKEN.
+// The endpoints are disabled when no token is configured.
+func adminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-Admin-Token")
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Forbidden"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// UnlockLogin godoc
+// @Summary      Unlock login / Снять блокировку входа
+// @Description  Clear failed login attempts of an account and/or a client IP. Requires the X-Admin-Token header / Сбросить неудачные попытки входа для аккаунта и/или IP
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token  header  string         true  "Admin token / Токен администратора"
+// @Param        data           body    UnlockRequest  true  "Account and/or IP / Аккаунт и/или IP"
+// @Success      200   {object}  MessageResponse
+// @Failure      400,403,500   {object}  ErrorResponse
+// @Router       /api/v1/admin/unlock [post]
+func unlockLogin(c *gin.Context) {
+	var req UnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Username == "" && req.IP == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Provide username or ip"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if req.Username != "" {
+		if err := accountAttempts.Reset(ctx, req.Username); err != nil {
+			log.Printf("Failed to unlock account %s: %v", req.Username, err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to unlock"})
+			return
+		}
+	}
+	if req.IP != "" {
+		if err := ipAttempts.Reset(ctx, req.IP); err != nil {
+			log.Printf("Failed to unlock IP %s: %v", req.IP, err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to unlock"})
+			return
+		}
+	}
+
+	log.Printf("Login unlocked (username=%q ip=%q)", req.Username, req.IP)
+	c.JSON(http.StatusOK, MessageResponse{Message: "Unlocked"})
+}
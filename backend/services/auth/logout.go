@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MessageResponse struct {
+	Message string `json:"message" example:"Logged out successfully"`
+}
+
+// Logout godoc
+// @Summary      Logout / Выход
+// @Description  Revoke the current access token and its refresh-token session / Отозвать текущий токен и сессию
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200   {object}  MessageResponse
+// @Failure      401,500   {object}  ErrorResponse
+// @Router       /api/v1/logout [post]
+func logout(c *gin.Context) {
+	ttl := accessTokenTTL
+	if expiresAt, ok := c.Get("expires_at"); ok {
+		ttl = time.Until(expiresAt.(time.Time))
+	}
+
+	if err := revoked.RevokeToken(c.Request.Context(), c.GetString("jti"), ttl); err != nil {
+		log.Printf("Failed to revoke token: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log out"})
+		return
+	}
+
+	if sessionID := c.GetString("session_id"); sessionID != "" {
+		if err := revokeRefreshFamily(sessionID); err != nil {
+			log.Printf("Failed to revoke session %s: %v", sessionID, err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log out"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Logged out successfully"})
+}
+
+// LogoutAll godoc
+// @Summary      Logout everywhere / Выйти на всех устройствах
+// @Description  Revoke every access and refresh token of the user / Отозвать все токены пользователя
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200   {object}  MessageResponse
+// @Failure      401,500   {object}  ErrorResponse
+// @Router       /api/v1/logout/all [post]
+func logoutAll(c *gin.Context) {
+	if err := revokeAllSessions(c.GetString("user_id")); err != nil {
+		log.Printf("Failed to revoke sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Logged out from all devices"})
+}
+
+// revokeAllSessions invalidates every token issued to the user so far.
+func revokeAllSessions(userID string) error {
+	if _, err := db.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", userID); err != nil {
+		return err
+	}
+	return revoked.RevokeUser(context.Background(), userID, accessTokenTTL)
+}
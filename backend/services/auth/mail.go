@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"time"
+
+	"hydration-tracking/services/auth/internal/mail"
+)
+
+var (
+	mailer     mail.Mailer = mail.LogMailer{}
+	appBaseURL             = "http://localhost:3000"
+)
+
+func initMailer() {
+	m, err := mail.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	mailer = m
+	appBaseURL = getEnv("APP_BASE_URL", appBaseURL)
+}
+
+// appLink builds a frontend URL carrying a one-time token.
+func appLink(path, token string) string {
+	return appBaseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendMailAsync delivers msg in the background so response time doesn't
+// reveal whether an address belongs to an account.
+func sendMailAsync(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := mailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send %q mail: %v", msg.Subject, err)
+		}
+	}()
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"hydration-tracking/services/auth/internal"
+	"hydration-tracking/services/auth/internal/mail"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"john@example.com"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required" example:"q4nY2v1e0y8mJm7n0rS2QeXo1mXh3sVQk2sYzj6q8bE"`
+	NewPassword string `json:"new_password" binding:"required,min=6" example:"newpassword123"`
+}
+
+var passwordResetTTL = time.Hour
+
+func initPasswordReset() {
+	passwordResetTTL = getEnvDuration("PASSWORD_RESET_TTL", passwordResetTTL)
+}
+
+func createPasswordResetsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS password_resets (
+		id UUID PRIMARY KEY,
+		user_id UUID NOT NULL,
+		token_hash CHAR(64) UNIQUE NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets(user_id);`)
+	return err
+}
+
+// ForgotPassword godoc
+// @Summary      Request password reset / Запросить сброс пароля
+// @Description  Email a single-use reset link. The response is the same whether or not the address is registered / Отправить ссылку для сброса пароля
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        data  body  ForgotPasswordRequest  true  "Account email / Email аккаунта"
+// @Success      202   {object}  MessageResponse
+// @Failure      400   {object}  ErrorResponse
+// @Router       /api/v1/password/forgot [post]
+func forgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	accepted := MessageResponse{Message: "If the email is registered, a reset link has been sent"}
+
+	var userID string
+	err := db.QueryRow("SELECT id FROM users WHERE email = $1 AND deleted_at IS NULL", req.Email).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to request password reset"})
+		return
+	}
+
+	token, err := internal.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to request password reset"})
+		return
+	}
+
+	// Only the most recent link works
+	if _, err := db.Exec("DELETE FROM password_resets WHERE user_id = $1 AND used_at IS NULL", userID); err != nil {
+		log.Printf("Failed to clear old reset tokens for user %s: %v", userID, err)
+	}
+	_, err = db.Exec(`INSERT INTO password_resets (id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4))`,
+		uuid.New().String(), userID, internal.HashToken(token), int(passwordResetTTL.Seconds()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to request password reset"})
+		return
+	}
+
+	sendMailAsync(mail.Message{
+		To:      req.Email,
+		Subject: "Reset your Hydration Tracker password",
+		Body: fmt.Sprintf("Someone requested a password reset for your account.\n\n"+
+			"Open this link to choose a new password (valid for %d minutes):\n%s\n\n"+
+			"If it wasn't you, ignore this email; your password stays unchanged.\n",
+			int(passwordResetTTL.Minutes()), appLink("/reset-password", token)),
+	})
+
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// ResetPassword godoc
+// @Summary      Reset password / Сбросить пароль
+// @Description  Set a new password with a reset token and sign out every session / Установить новый пароль по токену
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        data  body  ResetPasswordRequest  true  "Reset token and new password / Токен и новый пароль"
+// @Success      200   {object}  MessageResponse
+// @Failure      400,500   {object}  ErrorResponse
+// @Router       /api/v1/password/reset [post]
+func resetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		respondHashError(c, err)
+		return
+	}
+
+	var userID string
+	err = db.QueryRow(`UPDATE password_resets SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id`, internal.HashToken(req.Token)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password"})
+		return
+	}
+
+	if _, err := db.Exec("UPDATE users SET password = $1 WHERE id = $2", hashedPassword, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password"})
+		return
+	}
+
+	if err := revokeAllSessions(userID); err != nil {
+		log.Printf("Failed to revoke sessions after password reset for user %s: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Password has been reset"})
+}
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"hydration-tracking/internal/tz"
+	"hydration-tracking/internal/units"
+	"hydration-tracking/services/auth/internal/mail"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type ProfileResponse struct {
+	UserInfo
+	Timezone  string    `json:"timezone" example:"Asia/Vladivostok"`
+	Unit      string    `json:"unit" example:"ml"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-15T10:30:00Z"`
+}
+
+type UpdateProfileRequest struct {
+	Username *string `json:"username" binding:"omitempty,min=3,max=50" example:"john_doe"`
+	Email    *string `json:"email" binding:"omitempty,email,max=100" example:"john@example.com"`
+	// Timezone is an IANA zone name; daily stats reset at midnight in it
+	Timezone *string `json:"timezone" example:"Asia/Vladivostok"`
+	// Unit is the volume unit amounts are shown in: ml, fl_oz_us, fl_oz_uk or cup_us
+	Unit *string `json:"unit" example:"fl_oz_us"`
+	// CurrentPassword is required to change the email, which controls password resets
+	CurrentPassword string `json:"current_password" example:"password123"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required" example:"password123"`
+	NewPassword     string `json:"new_password" binding:"required,min=6" example:"newpassword456"`
+}
+
+type ChangePasswordResponse struct {
+	Message   string `json:"message" example:"Password changed successfully"`
+	Token     string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	ExpiresIn int    `json:"expires_in" example:"900"`
+}
+
+// createProfileColumns adds the profile settings shared with the hydration
+// service, which reads them from the users table.
+func createProfileColumns() error {
+	_, err := db.Exec(`
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT '` + tz.Default + `';
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS unit VARCHAR(16) NOT NULL DEFAULT '` + string(units.Default) + `';`)
+	return err
+}
+
+// isUniqueViolation reports whether err comes from a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func loadProfile(userID string) (ProfileResponse, error) {
+	profile := ProfileResponse{UserInfo: UserInfo{ID: userID}}
+	err := db.QueryRow("SELECT username, email, email_verified_at IS NOT NULL, timezone, unit, created_at FROM users WHERE id = $1", userID).
+		Scan(&profile.Username, &profile.Email, &profile.EmailVerified, &profile.Timezone, &profile.Unit, &profile.CreatedAt)
+	return profile, err
+}
+
+// confirmPassword checks the current password of the authenticated user.
+// Guesses count against the login lockout so a stolen access token can't be
+// used to brute-force the password. It writes the error response on failure.
+func confirmPassword(c *gin.Context, userID, password string) (User, bool) {
+	username := c.GetString("username")
+	if loginThrottled(c, username) {
+		return User{}, false
+	}
+
+	user := User{ID: userID}
+	err := db.QueryRow("SELECT username, email, password, email_verified_at IS NOT NULL FROM users WHERE id = $1", userID).
+		Scan(&user.Username, &user.Email, &user.Password, &user.EmailVerified)
+	if err != nil || !checkPassword(password, user.Password) {
+		recordLoginFailure(c, username)
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid credentials"})
+		return User{}, false
+	}
+	return user, true
+}
+
+// GetProfile godoc
+// @Summary      Get profile / Получить профиль
+// @Description  Get the profile of the current user / Получить профиль текущего пользователя
+// @Tags         profile
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200   {object}  ProfileResponse
+// @Failure      401,404,500   {object}  ErrorResponse
+// @Router       /api/v1/profile [get]
+func getProfile(c *gin.Context) {
+	profile, err := loadProfile(c.GetString("user_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateProfile godoc
+// @Summary      Update profile / Обновить профиль
+// @Description  Change username, email, timezone and/or volume unit. A new email must be verified again and requires current_password. Refresh the session to get tokens with the new data / Изменить имя пользователя, email, часовой пояс и/или единицу объёма
+// @Tags         profile
+// @Accept       json
+// @Produce      json
+// @Param        data  body  UpdateProfileRequest  true  "Profile changes / Изменения профиля"
+// @Security     BearerAuth
+// @Success      200   {object}  ProfileResponse
+// @Failure      400,401,409,429,500   {object}  ErrorResponse
+// @Router       /api/v1/profile [patch]
+func updateProfile(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Username == nil && req.Email == nil && req.Timezone == nil && req.Unit == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Nothing to update"})
+		return
+	}
+	if req.Timezone != nil {
+		if _, err := tz.Load(*req.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Unknown timezone, use an IANA name such as Europe/Moscow"})
+			return
+		}
+	}
+	if req.Unit != nil {
+		if _, err := units.Parse(*req.Unit); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	current, err := loadProfile(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update profile"})
+		return
+	}
+
+	// Everything is checked before anything is written, so a rejected request
+	// changes nothing.
+	var sets []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	usernameChanged := req.Username != nil && *req.Username != current.Username
+	emailChanged := req.Email != nil && *req.Email != current.Email
+	if emailChanged {
+		if _, ok := confirmPassword(c, userID, req.CurrentPassword); !ok {
+			return
+		}
+	}
+	if usernameChanged {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE username = $1 AND id <> $2)", *req.Username, userID).Scan(&exists)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update profile"})
+			return
+		}
+		if exists {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Username already taken"})
+			return
+		}
+		set("username", *req.Username)
+	}
+	if req.Timezone != nil && *req.Timezone != current.Timezone {
+		set("timezone", *req.Timezone)
+	}
+	if req.Unit != nil && *req.Unit != current.Unit {
+		set("unit", *req.Unit)
+	}
+	if emailChanged {
+		set("email", *req.Email)
+		sets = append(sets, "email_verified_at = NULL")
+	}
+
+	if len(sets) > 0 {
+		args = append(args, userID)
+		_, err := db.Exec(fmt.Sprintf("UPDATE users SET %s WHERE id = $%d", strings.Join(sets, ", "), len(args)), args...)
+		if isUniqueViolation(err) {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && strings.Contains(pqErr.Constraint, "username") {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "Username already taken"})
+			} else {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "Email already in use"})
+			}
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update profile"})
+			return
+		}
+	}
+
+	if emailChanged {
+		if verificationPolicy != verificationOff {
+			if err := sendVerificationEmail(userID, *req.Email); err != nil {
+				log.Printf("Failed to send verification email to user %s: %v", userID, err)
+			}
+		}
+		// Tell the old address, in case someone else made the change
+		sendMailAsync(mail.Message{
+			To:      current.Email,
+			Subject: "Your Hydration Tracker email was changed",
+			Body: "The email address of your Hydration Tracker account was changed to " + *req.Email + ".\n\n" +
+				"If you didn't do this, reset your password and contact support.\n",
+		})
+	}
+
+	profile, err := loadProfile(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get profile"})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// ChangePassword godoc
+// @Summary      Change password / Сменить пароль
+// @Description  Change the password after confirming the current one. Every other session is revoked; the response carries a new access token for this session / Сменить пароль, остальные сессии завершаются
+// @Tags         profile
+// @Accept       json
+// @Produce      json
+// @Param        data  body  ChangePasswordRequest  true  "Current and new password / Текущий и новый пароль"
+// @Security     BearerAuth
+// @Success      200   {object}  ChangePasswordResponse
+// @Failure      400,401,429,500   {object}  ErrorResponse
+// @Router       /api/v1/profile/password [put]
+func changePassword(c *gin.Context) {
+	userID := c.GetString("user_id")
+	sessionID := c.GetString("session_id")
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := confirmPassword(c, userID, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		respondHashError(c, err)
+		return
+	}
+	if _, err := db.Exec("UPDATE users SET password = $1 WHERE id = $2", hashedPassword, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change password"})
+		return
+	}
+
+	// Keep this session's refresh token, end every other one. Access tokens
+	// issued so far are cut off, so this client gets a fresh one.
+	_, err = db.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND family_id::text <> $2 AND revoked_at IS NULL",
+		userID, sessionID)
+	if err == nil {
+		err = revoked.RevokeUser(context.Background(), userID, accessTokenTTL)
+	}
+	if err != nil {
+		log.Printf("Failed to revoke sessions of user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ChangePasswordResponse{
+		Message:   "Password changed successfully",
+		Token:     generateToken(user, sessionID),
+		ExpiresIn: int(accessTokenTTL.Seconds()),
+	})
+}
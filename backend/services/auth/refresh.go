@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"hydration-tracking/services/auth/internal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"q4nY2v1e0y8mJm7n0rS2QeXo1mXh3sVQk2sYzj6q8bE"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string `json:"refresh_token" example:"q4nY2v1e0y8mJm7n0rS2QeXo1mXh3sVQk2sYzj6q8bE"`
+	ExpiresIn    int    `json:"expires_in" example:"900"`
+}
+
+var (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+func initTokenTTLs() {
+	accessTokenTTL = getEnvDuration("ACCESS_TOKEN_TTL", accessTokenTTL)
+	refreshTokenTTL = getEnvDuration("REFRESH_TOKEN_TTL", refreshTokenTTL)
+}
+
+func createRefreshTokensTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id UUID PRIMARY KEY,
+		family_id UUID NOT NULL,
+		user_id UUID NOT NULL,
+		token_hash CHAR(64) UNIQUE NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		used_at TIMESTAMP,
+		revoked_at TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);`)
+	return err
+}
+
+// issueTokens starts a new refresh-token family (one per login) and returns
+// an access token bound to it.
+func issueTokens(user User) (TokenResponse, error) {
+	familyID := uuid.New().String()
+	return issueTokensInFamily(user, familyID)
+}
+
+func issueTokensInFamily(user User, familyID string) (TokenResponse, error) {
+	refreshToken, err := internal.NewOpaqueToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	_, err = db.Exec(`INSERT INTO refresh_tokens (id, family_id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(secs => $5))`,
+		uuid.New().String(), familyID, user.ID, internal.HashToken(refreshToken), int(refreshTokenTTL.Seconds()))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	return TokenResponse{
+		Token:        generateToken(user, familyID),
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func revokeRefreshFamily(familyID string) error {
+	_, err := db.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL", familyID)
+	return err
+}
+
+// Refresh godoc
+// @Summary      Refresh access token / Обновить токен доступа
+// @Description  Exchange a refresh token for a new access and refresh token. Replaying a used refresh token revokes the whole session / Обменять refresh-токен на новую пару токенов
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        data  body  RefreshRequest  true  "Refresh token / Refresh-токен"
+// @Success      200   {object}  TokenResponse
+// @Failure      400,401   {object}  ErrorResponse
+// @Router       /api/v1/refresh [post]
+func refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	tokenHash := internal.HashToken(req.RefreshToken)
+
+	// Consume the token atomically so two concurrent requests can't both rotate it.
+	var familyID, userID string
+	err := db.QueryRow(`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING family_id, user_id`, tokenHash).Scan(&familyID, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		detectRefreshReuse(tokenHash)
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to refresh token"})
+		return
+	}
+
+	// Reload the user so the new access token reflects e.g. a verified email
+	user := User{ID: userID}
+	err = db.QueryRow("SELECT username, email, email_verified_at IS NOT NULL FROM users WHERE id = $1 AND deleted_at IS NULL",
+		userID).Scan(&user.Username, &user.Email, &user.EmailVerified)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid refresh token"})
+		return
+	}
+
+	tokens, err := issueTokensInFamily(user, familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// detectRefreshReuse revokes the family of a token that was already rotated.
+// Only a stolen copy (or the legitimate client after theft) can present it
+// again, and we can't tell which one is which.
+func detectRefreshReuse(tokenHash string) {
+	var familyID string
+	var usedAt sql.NullTime
+	err := db.QueryRow("SELECT family_id, used_at FROM refresh_tokens WHERE token_hash = $1", tokenHash).Scan(&familyID, &usedAt)
+	if err != nil || !usedAt.Valid {
+		return
+	}
+
+	log.Printf("Refresh token reuse detected, revoking session %s", familyID)
+	if err := revokeRefreshFamily(familyID); err != nil {
+		log.Printf("Failed to revoke session %s: %v", familyID, err)
+	}
+}
@@ -5,14 +5,19 @@ package auth
 // @Name Authorization
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
+	"hydration-tracking/internal/revocation"
 	"hydration-tracking/services/auth/docs"
+	"hydration-tracking/services/auth/internal"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -29,10 +34,11 @@ type Database interface {
 }
 
 type User struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	Password      string `json:"password"`
+	EmailVerified bool   `json:"email_verified"`
 }
 
 type LoginRequest struct {
@@ -52,14 +58,17 @@ type RegisterResponse struct {
 }
 
 type LoginResponse struct {
-	Token string   `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
-	User  UserInfo `json:"user"`
+	Token        string   `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string   `json:"refresh_token" example:"q4nY2v1e0y8mJm7n0rS2QeXo1mXh3sVQk2sYzj6q8bE"`
+	ExpiresIn    int      `json:"expires_in" example:"900"`
+	User         UserInfo `json:"user"`
 }
 
 type UserInfo struct {
-	ID       string `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
-	Username string `json:"username" example:"john_doe"`
-	Email    string `json:"email" example:"john@example.com"`
+	ID            string `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Username      string `json:"username" example:"john_doe"`
+	Email         string `json:"email" example:"john@example.com"`
+	EmailVerified bool   `json:"email_verified" example:"true"`
 }
 
 type ErrorResponse struct {
@@ -67,22 +76,28 @@ type ErrorResponse struct {
 }
 
 type Claims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid,omitempty"`
+	// Unverified marks read-only tokens of users who haven't verified their email
+	Unverified bool `json:"unverified,omitempty"`
+	// Purpose is set on special-use tokens (e.g. MFA challenges), never on access tokens
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
 var (
-	db     Database
-	secret []byte
+	db        Database
+	passwords                  = internal.NewPasswordManager(internal.DefaultArgon2id())
+	revoked   revocation.Store = revocation.NewMemoryStore()
 )
 
-func initSecret() {
-	envSecret := os.Getenv("JWT_SECRET")
-	if envSecret == "" {
-		log.Fatal("JWT_SECRET env variable not set")
+func initRevocation() {
+	store, err := revocation.FromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
-	secret = []byte(envSecret)
+	revoked = store
 }
 
 func getEnv(key, defaultValue string) string {
@@ -92,6 +107,39 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// initPasswords selects the hasher for new and upgraded passwords.
+// Hashes from the other scheme and legacy plaintext rows keep verifying.
+func initPasswords() {
+	switch algorithm := getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"); algorithm {
+	case "bcrypt":
+		passwords = internal.NewPasswordManager(internal.BcryptHasher{Cost: getEnvInt("BCRYPT_COST", 12)})
+	case "argon2id":
+		hasher := internal.DefaultArgon2id()
+		hasher.Time = uint32(getEnvInt("ARGON2_TIME", int(hasher.Time)))
+		hasher.Memory = uint32(getEnvInt("ARGON2_MEMORY_KB", int(hasher.Memory)))
+		hasher.Threads = uint8(getEnvInt("ARGON2_THREADS", int(hasher.Threads)))
+		passwords = internal.NewPasswordManager(hasher)
+	default:
+		log.Fatalf("Unknown PASSWORD_HASH_ALGORITHM %q", algorithm)
+	}
+}
+
 func InitDB() {
 	// Load environment variables
 	dbHost := getEnv("DB_HOST", "localhost")
@@ -125,6 +173,25 @@ func InitDB() {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	if err := createRefreshTokensTable(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createPasswordResetsTable(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createEmailVerificationsTable(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createTwoFactorTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createAccountDeletionSchema(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createProfileColumns(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 // Register godoc
@@ -135,7 +202,7 @@ func InitDB() {
 // @Produce      json
 // @Param        data  body  RegisterRequest  true  "User data / Данные пользователя"
 // @Success      201   {object}  RegisterResponse
-// @Failure      400   {object}  ErrorResponse
+// @Failure      400,500   {object}  ErrorResponse
 // @Router       /api/v1/register [post]
 func register(c *gin.Context) {
 	var req RegisterRequest
@@ -145,15 +212,25 @@ func register(c *gin.Context) {
 	}
 
 	userID := uuid.New().String()
-	hashedPassword := hashPassword(req.Password) // In production, use bcrypt
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		respondHashError(c, err)
+		return
+	}
 
-	_, err := db.Exec("INSERT INTO users (id, username, email, password) VALUES ($1, $2, $3, $4)",
+	_, err = db.Exec("INSERT INTO users (id, username, email, password) VALUES ($1, $2, $3, $4)",
 		userID, req.Username, req.Email, hashedPassword)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Username or email already exists"})
 		return
 	}
 
+	if verificationPolicy != verificationOff {
+		if err := sendVerificationEmail(userID, req.Email); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", userID, err)
+		}
+	}
+
 	c.JSON(http.StatusCreated, RegisterResponse{Message: "User registered successfully", UserID: userID})
 }
 
@@ -165,7 +242,7 @@ func register(c *gin.Context) {
 // @Produce      json
 // @Param        data  body  LoginRequest  true  "Login data / Данные для входа"
 // @Success      200   {object}  LoginResponse
-// @Failure      400,401   {object}  ErrorResponse
+// @Failure      400,401,403,429   {object}  ErrorResponse
 // @Router       /api/v1/login [post]
 func login(c *gin.Context) {
 	var req LoginRequest
@@ -173,46 +250,125 @@ func login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if loginThrottled(c, req.Username) {
+		return
+	}
 
 	var user User
-	err := db.QueryRow("SELECT id, username, email, password FROM users WHERE username = $1",
-		req.Username).Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	var twoFactorEnabled, deleted bool
+	err := db.QueryRow(`SELECT id, username, email, password, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL, deleted_at IS NOT NULL
+		FROM users WHERE username = $1`, req.Username).
+		Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.EmailVerified, &twoFactorEnabled, &deleted)
 	if err != nil {
+		recordLoginFailure(c, req.Username)
 		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid credentials"})
 		return
 	}
 
-	if !checkPassword(req.Password, user.Password) {
+	ok, rehash, err := passwords.Verify(req.Password, user.Password)
+	if err != nil {
+		log.Printf("Failed to verify password for user %s: %v", user.ID, err)
+	}
+	if !ok {
+		recordLoginFailure(c, req.Username)
 		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid credentials"})
 		return
 	}
+	if rehash {
+		upgradePassword(user.ID, req.Password, user.Password)
+	}
 
-	token := generateToken(user.ID, user.Username)
-	c.JSON(http.StatusOK, LoginResponse{Token: token, User: UserInfo{ID: user.ID, Username: user.Username, Email: user.Email}})
+	if deleted {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Account is scheduled for deletion, restore it to log in"})
+		return
+	}
+	if verificationPolicy == verificationBlock && !user.EmailVerified {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Email address not verified"})
+		return
+	}
+
+	if twoFactorEnabled {
+		mfaToken, err := generateMFAChallenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create session"})
+			return
+		}
+		c.JSON(http.StatusOK, MFAChallengeResponse{MFARequired: true, MFAToken: mfaToken, ExpiresIn: int(mfaChallengeTTL.Seconds())})
+		return
+	}
+
+	// With 2FA the counter is only cleared once the second factor passes,
+	// otherwise re-entering a known password would reset code guessing.
+	recordLoginSuccess(c, req.Username)
+	respondWithSession(c, user)
+}
+
+// respondWithSession completes a login by starting a new session for user.
+func respondWithSession(c *gin.Context, user User) {
+	tokens, err := issueTokens(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         UserInfo{ID: user.ID, Username: user.Username, Email: user.Email, EmailVerified: user.EmailVerified},
+	})
 }
 
-func generateToken(userID, username string) string {
+// generateToken issues a short-lived access token. sessionID ties it to the
+// refresh-token family it was issued with.
+func generateToken(user User, sessionID string) string {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:     user.ID,
+		Username:   user.Username,
+		SessionID:  sessionID,
+		Unverified: limitedAccess(user),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, _ := token.SignedString(secret)
+	tokenString, _ := signingKeys.Sign(claims)
 	return tokenString
 }
 
-func hashPassword(password string) string {
-	// In production, use bcrypt
-	return password
+func hashPassword(password string) (string, error) {
+	return passwords.Hash(password)
+}
+
+// respondHashError answers 400 when the password itself can't be hashed and
+// 500 when hashing failed for any other reason (e.g. no randomness for a salt).
+func respondHashError(c *gin.Context, err error) {
+	if errors.Is(err, internal.ErrPasswordTooLong) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Password cannot be used"})
+		return
+	}
+	log.Printf("Failed to hash password: %v", err)
+	c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to hash password"})
 }
 
 func checkPassword(password, hashedPassword string) bool {
-	// In production, use bcrypt.CompareHashAndPassword
-	return password == hashedPassword
+	ok, _, err := passwords.Verify(password, hashedPassword)
+	return err == nil && ok
+}
+
+// upgradePassword replaces a plaintext or weaker hash after a successful login.
+// The old value is part of the condition so a concurrent password change wins.
+func upgradePassword(userID, password, oldHash string) {
+	newHash, err := hashPassword(password)
+	if err != nil {
+		log.Printf("Failed to rehash password for user %s: %v", userID, err)
+		return
+	}
+	_, err = db.Exec("UPDATE users SET password = $1 WHERE id = $2 AND password = $3", newHash, userID, oldHash)
+	if err != nil {
+		log.Printf("Failed to upgrade password hash for user %s: %v", userID, err)
+	}
 }
 
 func authMiddleware() gin.HandlerFunc {
@@ -228,9 +384,7 @@ func authMiddleware() gin.HandlerFunc {
 			tokenString = tokenString[7:]
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return secret, nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, signingKeys.Keyfunc)
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid token"})
@@ -239,8 +393,50 @@ func authMiddleware() gin.HandlerFunc {
 		}
 
 		claims := token.Claims.(*Claims)
+		if claims.Purpose != "" {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		isRevoked, err := revoked.IsRevoked(c.Request.Context(), claims.ID, claims.UserID, issuedAt)
+		if err != nil {
+			log.Printf("Failed to check token revocation: %v", err)
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Session store unavailable"})
+			c.Abort()
+			return
+		}
+		if isRevoked {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("jti", claims.ID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("email_unverified", claims.Unverified)
+		if claims.ExpiresAt != nil {
+			c.Set("expires_at", claims.ExpiresAt.Time)
+		}
+		c.Next()
+	}
+}
+
+// requireVerifiedEmail blocks sensitive account changes until the email is
+// verified (EMAIL_VERIFICATION_POLICY=limit).
+func requireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("email_unverified") {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Email verification required"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -255,8 +451,20 @@ func authMiddleware() gin.HandlerFunc {
 // @Failure      401   {object}  map[string]string
 // @Router       /api/v1/profile [get]
 func StartServer() error {
-	initSecret()
+	initSigningKeys()
+	initPasswords()
+	initTokenTTLs()
+	initPasswordReset()
+	initRevocation()
+	initMailer()
+	initVerificationPolicy()
+	initLockout()
+	initAccountDeletion()
+	go runAccountPurger(context.Background())
 	r := gin.Default()
+	if err := setTrustedProxies(r); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
 
 	// Swagger documentation
 	docs.SwaggerInfo.Title = "Hydration Tracking Auth Service"
@@ -272,24 +480,39 @@ func StartServer() error {
 	r.GET("/health", func(c *gin.Context) {
 		c.String(200, "healthy")
 	})
+	r.GET("/.well-known/jwks.json", jwksHandler)
 
 	api := r.Group("/api/v1")
 	{
 		api.POST("/register", register)
 		api.POST("/login", login)
+		api.POST("/login/mfa", loginMFA)
+		api.POST("/refresh", refresh)
+		api.POST("/password/forgot", forgotPassword)
+		api.POST("/password/reset", resetPassword)
+		api.POST("/email/verify", verifyEmail)
+		api.POST("/email/resend", resendVerification)
+		api.POST("/account/restore", restoreAccount)
 
 		// Protected routes
 		protected := api.Group("/")
 		protected.Use(authMiddleware())
 		{
-			protected.GET("/profile", func(c *gin.Context) {
-				userID := c.GetString("user_id")
-				username := c.GetString("username")
-				c.JSON(http.StatusOK, gin.H{
-					"user_id":  userID,
-					"username": username,
-				})
-			})
+			protected.GET("/profile", getProfile)
+			protected.PATCH("/profile", updateProfile)
+			protected.PUT("/profile/password", changePassword)
+			protected.POST("/logout", logout)
+			protected.POST("/logout/all", logoutAll)
+			protected.POST("/2fa/enroll", requireVerifiedEmail(), enrollTOTP)
+			protected.POST("/2fa/confirm", requireVerifiedEmail(), confirmTOTP)
+			protected.POST("/2fa/disable", disableTOTP)
+			protected.DELETE("/account", deleteAccount)
+		}
+
+		admin := api.Group("/admin")
+		admin.Use(adminMiddleware())
+		{
+			admin.POST("/unlock", unlockLogin)
 		}
 	}
 
@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"hydration-tracking/services/auth/internal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer          = "Hydration Tracker"
+	recoveryCodeCount   = 10
+	mfaChallengeTTL     = 5 * time.Minute
+	purposeMFAChallenge = "mfa"
+)
+
+type EnrollTOTPResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/Hydration%20Tracker:john_doe?secret=JBSWY3DPEHPK3PXP&issuer=Hydration+Tracker"`
+}
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric" example:"123456"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"k3m9p-x7q2r"`
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password" binding:"required" example:"password123"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required" example:"true"`
+	MFAToken    string `json:"mfa_token" example:"eyJhbGciOiJFZERTQSIsImtpZCI6IjIwMjQtMDYtMDEifQ..."`
+	ExpiresIn   int    `json:"expires_in" example:"300"`
+}
+
+type LoginMFARequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required" example:"eyJhbGciOiJFZERTQSIsImtpZCI6IjIwMjQtMDYtMDEifQ..."`
+	Code         string `json:"code" example:"123456"`
+	RecoveryCode string `json:"recovery_code" example:"k3m9p-x7q2r"`
+}
+
+func createTwoFactorTables() error {
+	_, err := db.Exec(`
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64);
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;
+	CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+		id UUID PRIMARY KEY,
+		user_id UUID NOT NULL,
+		code_hash CHAR(64) NOT NULL,
+		used_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);`)
+	return err
+}
+
+// generateMFAChallenge issues the token that proves the password step of a
+// login succeeded. authMiddleware rejects it because it carries a purpose.
+func generateMFAChallenge(user User) (string, error) {
+	now := time.Now()
+	return signingKeys.Sign(Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Purpose:  purposeMFAChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+}
+
+// EnrollTOTP godoc
+// @Summary      Start 2FA enrollment / Начать подключение 2FA
+// @Description  Generate a TOTP secret to add to an authenticator app. 2FA is enabled after confirmation / Сгенерировать TOTP-секрет
+// @Tags         2fa
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200   {object}  EnrollTOTPResponse
+// @Failure      401,403,409   {object}  ErrorResponse
+// @Router       /api/v1/2fa/enroll [post]
+func enrollTOTP(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	secret, err := internal.NewTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start enrollment"})
+		return
+	}
+
+	result, err := db.Exec("UPDATE users SET totp_secret = $1 WHERE id = $2 AND totp_enabled_at IS NULL", secret, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start enrollment"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Two-factor authentication is already enabled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, EnrollTOTPResponse{
+		Secret:     secret,
+		OTPAuthURI: internal.TOTPURI(totpIssuer, c.GetString("username"), secret),
+	})
+}
+
+// ConfirmTOTP godoc
+// @Summary      Confirm 2FA enrollment / Подтвердить подключение 2FA
+// @Description  Enable 2FA with a code from the authenticator app and get one-time recovery codes / Включить 2FA и получить коды восстановления
+// @Tags         2fa
+// @Accept       json
+// @Produce      json
+// @Param        data  body  ConfirmTOTPRequest  true  "Authenticator code / Код из приложения"
+// @Security     BearerAuth
+// @Success      200   {object}  RecoveryCodesResponse
+// @Failure      400,401,403   {object}  ErrorResponse
+// @Router       /api/v1/2fa/confirm [post]
+func confirmTOTP(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req ConfirmTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var secret sql.NullString
+	err := db.QueryRow("SELECT totp_secret FROM users WHERE id = $1 AND totp_enabled_at IS NULL", userID).Scan(&secret)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !secret.Valid) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No pending two-factor enrollment"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to confirm enrollment"})
+		return
+	}
+
+	step, ok := internal.ValidateTOTP(secret.String, req.Code, time.Now(), 0)
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid code"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to confirm enrollment"})
+		return
+	}
+
+	_, err = db.Exec("UPDATE users SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_step = $1 WHERE id = $2 AND totp_secret = $3",
+		step, userID, secret.String)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to confirm enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func replaceRecoveryCodes(userID string) ([]string, error) {
+	codes, err := internal.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		_, err := db.Exec("INSERT INTO mfa_recovery_codes (id, user_id, code_hash) VALUES ($1, $2, $3)",
+			uuid.New().String(), userID, internal.HashToken(code))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// DisableTOTP godoc
+// @Summary      Disable 2FA / Отключить 2FA
+// @Description  Disable 2FA after re-entering the password / Отключить 2FA с подтверждением пароля
+// @Tags         2fa
+// @Accept       json
+// @Produce      json
+// @Param        data  body  DisableTOTPRequest  true  "Current password / Текущий пароль"
+// @Security     BearerAuth
+// @Success      200   {object}  MessageResponse
+// @Failure      400,401,429   {object}  ErrorResponse
+// @Router       /api/v1/2fa/disable [post]
+func disableTOTP(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req DisableTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if _, ok := confirmPassword(c, userID, req.Password); !ok {
+		return
+	}
+
+	_, err := db.Exec("UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = $1", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to disable two-factor authentication"})
+		return
+	}
+	if _, err := db.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		log.Printf("Failed to delete recovery codes for user %s: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Two-factor authentication disabled"})
+}
+
+// LoginMFA godoc
+// @Summary      Complete 2FA login / Завершить вход с 2FA
+// @Description  Exchange the MFA token from login and an authenticator or recovery code for a session / Завершить вход кодом 2FA
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        data  body  LoginMFARequest  true  "MFA token and code / MFA-токен и код"
+// @Success      200   {object}  LoginResponse
+// @Failure      400,401,429   {object}  ErrorResponse
+// @Router       /api/v1/login/mfa [post]
+func loginMFA(c *gin.Context) {
+	var req LoginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Provide either code or recovery_code"})
+		return
+	}
+
+	token, err := jwt.ParseWithClaims(req.MFAToken, &Claims{}, signingKeys.Keyfunc)
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired MFA token"})
+		return
+	}
+	claims := token.Claims.(*Claims)
+	if claims.Purpose != purposeMFAChallenge {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired MFA token"})
+		return
+	}
+	if isRevoked, err := revoked.IsRevoked(c.Request.Context(), claims.ID, claims.UserID, claims.IssuedAt.Time); err != nil || isRevoked {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired MFA token"})
+		return
+	}
+	// Second-factor guesses count against the same account budget as passwords
+	if loginThrottled(c, claims.Username) {
+		return
+	}
+
+	user := User{ID: claims.UserID}
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+	err = db.QueryRow(`SELECT username, email, email_verified_at IS NOT NULL, totp_secret, totp_last_step
+		FROM users WHERE id = $1 AND totp_enabled_at IS NOT NULL AND deleted_at IS NULL`, user.ID).
+		Scan(&user.Username, &user.Email, &user.EmailVerified, &secret, &lastStep)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired MFA token"})
+		return
+	}
+
+	if req.Code != "" {
+		step, ok := internal.ValidateTOTP(secret.String, req.Code, time.Now(), lastStep.Int64)
+		if ok {
+			// Record the step so the same code can't be used twice
+			result, err := db.Exec("UPDATE users SET totp_last_step = $1 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)", step, user.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify code"})
+				return
+			}
+			n, _ := result.RowsAffected()
+			ok = n == 1
+		}
+		if !ok {
+			recordLoginFailure(c, claims.Username)
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid code"})
+			return
+		}
+	} else {
+		result, err := db.Exec("UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+			user.ID, internal.HashToken(internal.NormalizeRecoveryCode(req.RecoveryCode)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify code"})
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			recordLoginFailure(c, claims.Username)
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid recovery code"})
+			return
+		}
+	}
+
+	recordLoginSuccess(c, claims.Username)
+
+	// The challenge is single use
+	if err := revoked.RevokeToken(c.Request.Context(), claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+		log.Printf("Failed to revoke MFA token: %v", err)
+	}
+
+	respondWithSession(c, user)
+}
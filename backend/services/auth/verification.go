@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"hydration-tracking/services/auth/internal"
+	"hydration-tracking/services/auth/internal/mail"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Email verification policies, set with EMAIL_VERIFICATION_POLICY.
+const (
+	// verificationOff ignores verification status.
+	verificationOff = "off"
+	// verificationLimit lets unverified users log in with read-only access tokens.
+	verificationLimit = "limit"
+	// verificationBlock refuses login until the address is verified.
+	verificationBlock = "block"
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required" example:"q4nY2v1e0y8mJm7n0rS2QeXo1mXh3sVQk2sYzj6q8bE"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email" example:"john@example.com"`
+}
+
+// The default is off until the app has a verification screen; with limit or
+// block a new account can't log water from the app.
+var (
+	verificationPolicy = verificationOff
+	verificationTTL    = 48 * time.Hour
+)
+
+func initVerificationPolicy() {
+	switch policy := getEnv("EMAIL_VERIFICATION_POLICY", verificationPolicy); policy {
+	case verificationOff, verificationLimit, verificationBlock:
+		verificationPolicy = policy
+	default:
+		log.Fatalf("Unknown EMAIL_VERIFICATION_POLICY %q", policy)
+	}
+	verificationTTL = getEnvDuration("EMAIL_VERIFICATION_TTL", verificationTTL)
+}
+
+// createEmailVerificationsTable adds users.email_verified_at. Accounts created
+// before verification existed are treated as verified: the column is filled
+// from created_at once, when it is added.
+func createEmailVerificationsTable() error {
+	_, err := db.Exec(`
+	DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'users' AND column_name = 'email_verified_at'
+		) THEN
+			ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+			UPDATE users SET email_verified_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+		END IF;
+	END $$;
+	CREATE TABLE IF NOT EXISTS email_verifications (
+		id UUID PRIMARY KEY,
+		user_id UUID NOT NULL,
+		email VARCHAR(100) NOT NULL,
+		token_hash CHAR(64) UNIQUE NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications(user_id);`)
+	return err
+}
+
+// limitedAccess reports whether tokens for user must be restricted.
+func limitedAccess(user User) bool {
+	return verificationPolicy == verificationLimit && !user.EmailVerified
+}
+
+// sendVerificationEmail replaces any pending verification of the user with a
+// new token for email.
+func sendVerificationEmail(userID, email string) error {
+	token, err := internal.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM email_verifications WHERE user_id = $1 AND used_at IS NULL", userID); err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO email_verifications (id, user_id, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(secs => $5))`,
+		uuid.New().String(), userID, email, internal.HashToken(token), int(verificationTTL.Seconds()))
+	if err != nil {
+		return err
+	}
+
+	sendMailAsync(mail.Message{
+		To:      email,
+		Subject: "Confirm your Hydration Tracker email",
+		Body: fmt.Sprintf("Welcome to Hydration Tracker!\n\n"+
+			"Open this link to confirm your email address (valid for %d hours):\n%s\n",
+			int(verificationTTL.Hours()), appLink("/verify-email", token)),
+	})
+	return nil
+}
+
+// VerifyEmail godoc
+// @Summary      Verify email / Подтвердить email
+// @Description  Confirm an email address with the emailed token. Refresh the session afterwards to lift access limits / Подтвердить email по токену из письма
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        data  body  VerifyEmailRequest  true  "Verification token / Токен подтверждения"
+// @Success      200   {object}  MessageResponse
+// @Failure      400   {object}  ErrorResponse
+// @Router       /api/v1/email/verify [post]
+func verifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var userID, email string
+	err := db.QueryRow(`UPDATE email_verifications SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id, email`, internal.HashToken(req.Token)).Scan(&userID, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired verification token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify email"})
+		return
+	}
+
+	// The address may have changed since the link was sent
+	result, err := db.Exec("UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE id = $1 AND email = $2", userID, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify email"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired verification token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Email verified successfully"})
+}
+
+// ResendVerification godoc
+// @Summary      Resend verification email / Повторно отправить письмо
+// @Description  Send a new verification link. The response is the same whether or not the address is registered / Отправить новую ссылку подтверждения
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        data  body  ResendVerificationRequest  true  "Account email / Email аккаунта"
+// @Success      202   {object}  MessageResponse
+// @Failure      400   {object}  ErrorResponse
+// @Router       /api/v1/email/resend [post]
+func resendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	accepted := MessageResponse{Message: "If the email awaits verification, a new link has been sent"}
+
+	var userID string
+	err := db.QueryRow("SELECT id FROM users WHERE email = $1 AND email_verified_at IS NULL AND deleted_at IS NULL", req.Email).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to send verification email"})
+		return
+	}
+
+	if err := sendVerificationEmail(userID, req.Email); err != nil {
+		log.Printf("Failed to create verification token for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, accepted)
+}
@@ -0,0 +1,241 @@
+package hydration
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"hydration-tracking/services/hydration/internal"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Achievement is a badge with the user's progress toward it.
+type Achievement struct {
+	ID          string `json:"id" example:"streak_7"`
+	Name        string `json:"name" example:"Week strong"`
+	Description string `json:"description" example:"Meet your goal 7 days in a row"`
+	Target      int    `json:"target" example:"7"`
+	// Progress is capped at Target; unlocked badges always show Target
+	Progress   int        `json:"progress" example:"4"`
+	Unlocked   bool       `json:"unlocked" example:"false"`
+	UnlockedAt *time.Time `json:"unlocked_at,omitempty" example:"2024-01-15T10:30:00Z"`
+}
+
+// createAchievementsTable stores unlocked badges. A badge stays unlocked even
+// if the entries that earned it are deleted later.
+func createAchievementsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS user_achievements (
+		user_id UUID NOT NULL,
+		achievement_id VARCHAR(50) NOT NULL,
+		unlocked_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, achievement_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	return err
+}
+
+// loadAchievementStats sums up the entries of the user for the achievement
+// rules. The entry totals are only queried withTotals and the streak is only
+// replayed withStreak; the fields of a part left out stay zero.
+func loadAchievementStats(userID string, loc *time.Location, withTotals, withStreak bool) (internal.AchievementStats, error) {
+	var stats internal.AchievementStats
+	if withTotals {
+		err := db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(amount), 0),
+				COUNT(DISTINCT COALESCE(custom_beverage_id::text, type)),
+				COUNT(DISTINCT (timestamp AT TIME ZONE $2)::date)
+					FILTER (WHERE EXTRACT(HOUR FROM timestamp AT TIME ZONE $2) < $3)
+			FROM hydration_entries WHERE user_id = $1`, userID, loc.String(), internal.EarlyBirdHour).
+			Scan(&stats.Entries, &stats.VolumeML, &stats.Beverages, &stats.EarlyBirdDays)
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	if withStreak {
+		streak, err := loadStreak(userID, loc)
+		if err != nil {
+			return stats, err
+		}
+		stats.LongestStreak = streak.Longest
+		stats.GoalDays = streak.MetDays
+	}
+	return stats, nil
+}
+
+// loadUnlockedAchievements returns when each badge of the user was unlocked.
+func loadUnlockedAchievements(userID string) (map[string]time.Time, error) {
+	rows, err := db.Query("SELECT achievement_id, unlocked_at FROM user_achievements WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unlockedAt := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		unlockedAt[id] = at
+	}
+	return unlockedAt, rows.Err()
+}
+
+// lockedAchievements returns the rules of the badges missing from unlockedAt.
+func lockedAchievements(unlockedAt map[string]time.Time) []internal.Achievement {
+	var locked []internal.Achievement
+	for _, rule := range internal.Achievements() {
+		if _, ok := unlockedAt[rule.ID]; !ok {
+			locked = append(locked, rule)
+		}
+	}
+	return locked
+}
+
+// unlockAchievements records the badges among locked whose rules stats meet
+// and returns the ones unlocked by this call. A badge recorded concurrently
+// keeps its original time.
+func unlockAchievements(userID string, stats internal.AchievementStats, locked []internal.Achievement) ([]string, error) {
+	var unlocked []string
+	for _, rule := range locked {
+		if !rule.Unlocked(stats) {
+			continue
+		}
+		var inserted string
+		err := db.QueryRow(`INSERT INTO user_achievements (user_id, achievement_id) VALUES ($1, $2)
+			ON CONFLICT (user_id, achievement_id) DO NOTHING
+			RETURNING achievement_id`, userID, rule.ID).Scan(&inserted)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return unlocked, err
+		}
+		unlocked = append(unlocked, inserted)
+	}
+	return unlocked, nil
+}
+
+// entryMetGoal reports whether entry made its day meet the goal. That is the
+// only way an entry can lengthen a streak or add a day with the goal met.
+func entryMetGoal(userID string, loc *time.Location, entry HydrationEntry) (bool, error) {
+	day := internal.BucketStart(entry.Timestamp.In(loc), internal.GranularityDay)
+	var total int
+	err := db.QueryRow(`SELECT COALESCE(SUM(effective_amount), 0) FROM hydration_entries
+		WHERE user_id = $1 AND timestamp >= $2 AND timestamp < $3`, userID, day, day.AddDate(0, 0, 1)).Scan(&total)
+	if err != nil {
+		return false, err
+	}
+
+	goals, err := loadGoalTimeline(userID)
+	if err != nil {
+		return false, err
+	}
+	adjustments, err := loadGoalAdjustments(userID, day, day)
+	if err != nil {
+		return false, err
+	}
+	goal := goals.WithAdjustments(adjustments)(day)
+	return total >= goal && total-entry.effectiveML < goal, nil
+}
+
+// unlockAchievementsAfterEntry evaluates the badges after entry was logged.
+// Only locked badges are checked, and only the stats an entry can change are
+// loaded: the streak is replayed just when entry met its day's goal. A failure
+// is only logged: the entry itself has been saved.
+func unlockAchievementsAfterEntry(userID string, entry HydrationEntry) []string {
+	unlocked, err := func() ([]string, error) {
+		unlockedAt, err := loadUnlockedAchievements(userID)
+		if err != nil {
+			return nil, err
+		}
+		locked := lockedAchievements(unlockedAt)
+
+		var withTotals, withStreak bool
+		for _, rule := range locked {
+			if rule.Metric.FromStreak() {
+				withStreak = true
+			} else {
+				withTotals = true
+			}
+		}
+		if !withTotals && !withStreak {
+			return nil, nil
+		}
+
+		loc := userLocation(userID)
+		if withStreak {
+			if withStreak, err = entryMetGoal(userID, loc, entry); err != nil {
+				return nil, err
+			}
+		}
+		stats, err := loadAchievementStats(userID, loc, withTotals, withStreak)
+		if err != nil {
+			return nil, err
+		}
+		return unlockAchievements(userID, stats, locked)
+	}()
+	if err != nil {
+		log.Printf("Failed to evaluate achievements of user %s: %v", userID, err)
+	}
+	return unlocked
+}
+
+// GetAchievements godoc
+// @Summary      Get achievements / Получить достижения
+// @Description  All badges with the user's progress and the time each unlocked one was earned. Badges are evaluated after every logged entry and on this request / Все достижения с прогрессом и временем получения
+// @Tags         achievements
+// @Produce      json
+// @Success      200   {array}   Achievement
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/achievements [get]
+func getAchievements(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	// Evaluating here also awards badges earned by entries made before a rule existed
+	unlockedAt, err := loadUnlockedAchievements(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch achievements"})
+		return
+	}
+	stats, err := loadAchievementStats(userID, userLocation(userID), true, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch achievements"})
+		return
+	}
+	if _, err := unlockAchievements(userID, stats, lockedAchievements(unlockedAt)); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch achievements"})
+		return
+	}
+	if unlockedAt, err = loadUnlockedAchievements(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch achievements"})
+		return
+	}
+
+	rules := internal.Achievements()
+	response := make([]Achievement, 0, len(rules))
+	for _, rule := range rules {
+		a := Achievement{
+			ID:          rule.ID,
+			Name:        rule.Name,
+			Description: rule.Description,
+			Target:      rule.Target,
+			Progress:    rule.Progress(stats),
+		}
+		if at, ok := unlockedAt[rule.ID]; ok {
+			a.Unlocked = true
+			a.UnlockedAt = &at
+			a.Progress = rule.Target
+		}
+		response = append(response, a)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
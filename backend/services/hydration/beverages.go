@@ -0,0 +1,71 @@
+package hydration
+
+import (
+	"log"
+	"net/http"
+
+	"hydration-tracking/services/hydration/internal"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Beverage struct {
+	ID              string  `json:"id" example:"coffee"`
+	Name            string  `json:"name" example:"Coffee"`
+	HydrationFactor float64 `json:"hydration_factor" example:"0.8"`
+	CaffeinePer100  float64 `json:"caffeine_mg_per_100ml" example:"40"`
+	SugarPer100     float64 `json:"sugar_g_per_100ml" example:"0"`
+}
+
+const unknownBeverageError = "Unknown beverage type, see GET /api/v1/beverages"
+
+// createEffectiveAmountColumn stores the amount that counts toward the goal
+// next to the raw volume. Entries logged before the catalog are filled in
+// from their type; unknown types count as water.
+func createEffectiveAmountColumn() error {
+	if _, err := db.Exec("ALTER TABLE hydration_entries ADD COLUMN IF NOT EXISTS effective_amount INTEGER"); err != nil {
+		return err
+	}
+
+	for _, b := range internal.Beverages() {
+		_, err := db.Exec("UPDATE hydration_entries SET effective_amount = ROUND(amount * $1::numeric) WHERE effective_amount IS NULL AND type = $2",
+			b.HydrationFactor, b.ID)
+		if err != nil {
+			return err
+		}
+	}
+	result, err := db.Exec("UPDATE hydration_entries SET effective_amount = amount WHERE effective_amount IS NULL")
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Counted %d entries of unknown beverage types as water", n)
+	}
+
+	_, err = db.Exec("ALTER TABLE hydration_entries ALTER COLUMN effective_amount SET NOT NULL")
+	return err
+}
+
+// GetBeverages godoc
+// @Summary      Get beverage catalog / Получить каталог напитков
+// @Description  Beverages accepted as entry type. hydration_factor is the share of the volume that counts toward the goal / Напитки, допустимые как тип записи, и доля объёма, засчитываемая в цель
+// @Tags         beverages
+// @Produce      json
+// @Success      200   {array}   Beverage
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Security     BearerAuth
+// @Router       /api/v1/beverages [get]
+func getBeverages(c *gin.Context) {
+	catalog := internal.Beverages()
+	response := make([]Beverage, 0, len(catalog))
+	for _, b := range catalog {
+		response = append(response, Beverage{
+			ID:              b.ID,
+			Name:            b.Name,
+			HydrationFactor: b.HydrationFactor,
+			CaffeinePer100:  b.CaffeinePer100ml,
+			SugarPer100:     b.SugarPer100ml,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
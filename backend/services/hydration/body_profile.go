@@ -0,0 +1,252 @@
+package hydration
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"hydration-tracking/services/hydration/internal"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Goal modes: a fixed goal is set by the user, an auto goal is recommended
+// from the body profile and follows its changes.
+const (
+	goalModeFixed = "fixed"
+	goalModeAuto  = "auto"
+)
+
+type BodyProfile struct {
+	WeightKg float64 `json:"weight_kg" example:"70.5"`
+	// AgeBand is one of 14-18, 19-30, 31-50, 51-70, 71+
+	AgeBand string `json:"age_band" example:"19-30"`
+	// Sex is female, male or other
+	Sex string `json:"sex" example:"female"`
+	// ActivityLevel is sedentary, light, moderate, active or very_active
+	ActivityLevel string    `json:"activity_level" example:"moderate"`
+	Pregnant      bool      `json:"pregnant" example:"false"`
+	Breastfeeding bool      `json:"breastfeeding" example:"false"`
+	UpdatedAt     time.Time `json:"updated_at" example:"2024-01-15T10:30:00Z"`
+}
+
+type UpdateBodyProfileRequest struct {
+	WeightKg      float64 `json:"weight_kg" binding:"required" example:"70.5"`
+	AgeBand       string  `json:"age_band" binding:"required" example:"19-30"`
+	Sex           string  `json:"sex" binding:"required" example:"female"`
+	ActivityLevel string  `json:"activity_level" binding:"required" example:"moderate"`
+	Pregnant      bool    `json:"pregnant" example:"false"`
+	Breastfeeding bool    `json:"breastfeeding" example:"false"`
+}
+
+// GoalRecommendation is the recommended daily goal with the parts it is made
+// of: Base + ActivityExtra + ReproductiveExtra, rounded to 50 ml and kept
+// within 1500-5000 ml.
+type GoalRecommendation struct {
+	Goal              float64 `json:"goal" example:"2400"`
+	Base              float64 `json:"base" example:"1890"`
+	ActivityExtra     float64 `json:"activity_extra" example:"500"`
+	ReproductiveExtra float64 `json:"reproductive_extra" example:"0"`
+	Unit              string  `json:"unit" example:"ml"`
+	// Mode is the user's goal mode; in auto mode Goal is the daily goal
+	Mode string `json:"mode" example:"fixed"`
+}
+
+// createBodyProfilesTable stores the body metrics the goal recommendation is
+// computed from, and the goal mode that decides whether it is applied.
+func createBodyProfilesTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS body_profiles (
+		user_id UUID PRIMARY KEY,
+		weight_kg NUMERIC(4,1) NOT NULL CHECK (weight_kg > 0),
+		age_band VARCHAR(8) NOT NULL,
+		sex VARCHAR(8) NOT NULL,
+		activity_level VARCHAR(16) NOT NULL,
+		pregnant BOOLEAN NOT NULL DEFAULT FALSE,
+		breastfeeding BOOLEAN NOT NULL DEFAULT FALSE,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	ALTER TABLE user_goals ADD COLUMN IF NOT EXISTS goal_mode VARCHAR(10) NOT NULL DEFAULT '` + goalModeFixed + `';`)
+	return err
+}
+
+func (p BodyProfile) metrics() internal.BodyProfile {
+	return internal.BodyProfile{
+		WeightKg:      p.WeightKg,
+		AgeBand:       internal.AgeBand(p.AgeBand),
+		Sex:           internal.Sex(p.Sex),
+		Activity:      internal.ActivityLevel(p.ActivityLevel),
+		Pregnant:      p.Pregnant,
+		Breastfeeding: p.Breastfeeding,
+	}
+}
+
+// loadBodyProfile returns sql.ErrNoRows when the user hasn't set one.
+func loadBodyProfile(userID string) (BodyProfile, error) {
+	var p BodyProfile
+	err := db.QueryRow(`SELECT weight_kg, age_band, sex, activity_level, pregnant, breastfeeding, updated_at
+		FROM body_profiles WHERE user_id = $1`, userID).
+		Scan(&p.WeightKg, &p.AgeBand, &p.Sex, &p.ActivityLevel, &p.Pregnant, &p.Breastfeeding, &p.UpdatedAt)
+	return p, err
+}
+
+func loadGoalMode(userID string) (string, error) {
+	var mode string
+	err := db.QueryRow("SELECT goal_mode FROM user_goals WHERE user_id = $1", userID).Scan(&mode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return goalModeFixed, nil
+	}
+	return mode, err
+}
+
+// autoGoal computes the goal of a user in auto mode. A goal that no longer
+// matches the profile, e.g. after the formula changed, is recorded from today.
+func autoGoal(userID string, stored int) int {
+	profile, err := loadBodyProfile(userID)
+	if err != nil {
+		log.Printf("Failed to load body profile of user %s: %v", userID, err)
+		return stored
+	}
+	goal := internal.Recommend(profile.metrics()).Goal
+	if goal != stored {
+		if err := saveGoal(userID, goal, goalModeAuto, time.Now().In(userLocation(userID))); err != nil {
+			log.Printf("Failed to save auto goal of user %s: %v", userID, err)
+		}
+	}
+	return goal
+}
+
+// GetBodyProfile godoc
+// @Summary      Get body profile / Получить параметры тела
+// @Description  Body metrics the goal recommendation is computed from / Параметры, по которым рассчитывается рекомендуемая цель
+// @Tags         goal
+// @Produce      json
+// @Success      200   {object}  BodyProfile
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Body profile not set"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/body-profile [get]
+func getBodyProfile(c *gin.Context) {
+	profile, err := loadBodyProfile(c.GetString("user_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Body profile not set"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch body profile"})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateBodyProfile godoc
+// @Summary      Set body profile / Задать параметры тела
+// @Description  Replace the body metrics. In auto goal mode the recommended goal is applied from today / Заменить параметры тела; в режиме auto новая цель действует с сегодняшнего дня
+// @Tags         goal
+// @Accept       json
+// @Produce      json
+// @Param        data  body  UpdateBodyProfileRequest  true  "Body metrics / Параметры тела"
+// @Success      200   {object}  BodyProfile
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/body-profile [put]
+func updateBodyProfile(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req UpdateBodyProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	profile := BodyProfile{
+		WeightKg:      req.WeightKg,
+		AgeBand:       req.AgeBand,
+		Sex:           req.Sex,
+		ActivityLevel: req.ActivityLevel,
+		Pregnant:      req.Pregnant,
+		Breastfeeding: req.Breastfeeding,
+	}
+	if err := profile.metrics().Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err := db.QueryRow(`INSERT INTO body_profiles (user_id, weight_kg, age_band, sex, activity_level, pregnant, breastfeeding)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET weight_kg = $2, age_band = $3, sex = $4, activity_level = $5,
+			pregnant = $6, breastfeeding = $7, updated_at = CURRENT_TIMESTAMP
+		RETURNING weight_kg, updated_at`,
+		userID, profile.WeightKg, profile.AgeBand, profile.Sex, profile.ActivityLevel, profile.Pregnant, profile.Breastfeeding).
+		Scan(&profile.WeightKg, &profile.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save body profile"})
+		return
+	}
+
+	mode, err := loadGoalMode(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save body profile"})
+		return
+	}
+	if mode == goalModeAuto {
+		goal := internal.Recommend(profile.metrics()).Goal
+		if err := saveGoal(userID, goal, goalModeAuto, time.Now().In(userLocation(userID))); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update goal"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetGoalRecommendation godoc
+// @Summary      Get recommended goal / Получить рекомендуемую цель
+// @Description  Daily goal recommended from the body profile: weight × ml per kg for the age band (14-18: 40, 19-30 and 31-50: 35, 51-70: 30, 71+: 25), × 0.9 for female and 0.95 for other, + activity (light 250, moderate 500, active 750, very active 1000 ml), + 300 ml when pregnant or 700 ml when breastfeeding; rounded to 50 ml and kept within 1500-5000 ml / Рекомендуемая цель по параметрам тела
+// @Tags         goal
+// @Produce      json
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {object}  GoalRecommendation
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Unknown unit"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Body profile not set"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/goal/recommendation [get]
+func getGoalRecommendation(c *gin.Context) {
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	profile, err := loadBodyProfile(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Body profile not set"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute recommendation"})
+		return
+	}
+	mode, err := loadGoalMode(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute recommendation"})
+		return
+	}
+
+	r := internal.Recommend(profile.metrics())
+	c.JSON(http.StatusOK, GoalRecommendation{
+		Goal:              unit.FromML(r.Goal),
+		Base:              unit.FromML(r.Base),
+		ActivityExtra:     unit.FromML(r.ActivityExtra),
+		ReproductiveExtra: unit.FromML(r.ReproductiveExtra),
+		Unit:              string(unit),
+		Mode:              mode,
+	})
+}
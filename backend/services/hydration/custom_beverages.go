@@ -0,0 +1,395 @@
+package hydration
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"hydration-tracking/internal/units"
+	"hydration-tracking/services/hydration/internal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// CustomBeverage is a drink defined by the user. The serving is stored in
+// milliliters and shown in Unit.
+type CustomBeverage struct {
+	ID                 string     `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Name               string     `json:"name" example:"Oat latte"`
+	Color              string     `json:"color" example:"#C8A27A"`
+	HydrationFactor    float64    `json:"hydration_factor" example:"0.85"`
+	CaffeinePerServing float64    `json:"caffeine_mg_per_serving" example:"75"`
+	Serving            float64    `json:"serving" example:"300"`
+	Unit               string     `json:"unit" example:"ml"`
+	ArchivedAt         *time.Time `json:"archived_at,omitempty" example:"2024-02-01T08:00:00Z"`
+	CreatedAt          time.Time  `json:"created_at" example:"2024-01-15T10:30:00Z"`
+
+	servingML int
+}
+
+type CreateCustomBeverageRequest struct {
+	Name  string `json:"name" binding:"required,max=50" example:"Oat latte"`
+	Color string `json:"color" binding:"omitempty,hexcolor" example:"#C8A27A"`
+	// HydrationFactor is the share of the volume that counts toward the goal, 0-1.5
+	HydrationFactor    *float64 `json:"hydration_factor" binding:"required,min=0,max=1.5" example:"0.85"`
+	CaffeinePerServing float64  `json:"caffeine_mg_per_serving" binding:"min=0,max=1000" example:"75"`
+	// Serving is the amount logged when an entry doesn't specify one
+	Serving float64 `json:"serving" binding:"required,gt=0" example:"300"`
+	// Unit of serving and of the response, defaults to the unit in the user's profile
+	Unit string `json:"unit" example:"ml"`
+}
+
+type UpdateCustomBeverageRequest struct {
+	Name               *string  `json:"name" binding:"omitempty,min=1,max=50" example:"Oat latte"`
+	Color              *string  `json:"color" binding:"omitempty,hexcolor" example:"#C8A27A"`
+	HydrationFactor    *float64 `json:"hydration_factor" binding:"omitempty,min=0,max=1.5" example:"0.85"`
+	CaffeinePerServing *float64 `json:"caffeine_mg_per_serving" binding:"omitempty,min=0,max=1000" example:"75"`
+	Serving            *float64 `json:"serving" binding:"omitempty,gt=0" example:"300"`
+	Unit               string   `json:"unit" example:"ml"`
+	// Archived set to false brings an archived drink back
+	Archived *bool `json:"archived" example:"false"`
+}
+
+// maxServingML is the largest serving of a custom drink
+const maxServingML = 2000
+
+const (
+	defaultBeverageColor  = "#4FC3F7"
+	customBeverageColumns = "id, name, color, hydration_factor, caffeine_mg_per_serving, serving_ml, archived_at, created_at"
+)
+
+var (
+	errUnknownCustomBeverage  = errors.New("custom beverage not found")
+	errArchivedCustomBeverage = errors.New("custom beverage is archived")
+)
+
+// createCustomBeveragesTable stores drinks defined by users. They are
+// archived rather than deleted because entries keep referencing them.
+func createCustomBeveragesTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS custom_beverages (
+		id UUID PRIMARY KEY,
+		user_id UUID NOT NULL,
+		name VARCHAR(50) NOT NULL,
+		color VARCHAR(7) NOT NULL DEFAULT '` + defaultBeverageColor + `',
+		hydration_factor DOUBLE PRECISION NOT NULL CHECK (hydration_factor >= 0 AND hydration_factor <= 1.5),
+		caffeine_mg_per_serving DOUBLE PRECISION NOT NULL DEFAULT 0,
+		serving_ml INTEGER NOT NULL CHECK (serving_ml > 0),
+		archived_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_beverages_user_name ON custom_beverages(user_id, lower(name)) WHERE archived_at IS NULL;
+	ALTER TABLE hydration_entries ADD COLUMN IF NOT EXISTS custom_beverage_id UUID REFERENCES custom_beverages(id) ON DELETE CASCADE;
+	CREATE INDEX IF NOT EXISTS idx_hydration_entries_custom_beverage ON hydration_entries(custom_beverage_id) WHERE custom_beverage_id IS NOT NULL;`)
+	return err
+}
+
+// isUniqueViolation reports whether err comes from a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanCustomBeverage(row rowScanner) (CustomBeverage, error) {
+	var b CustomBeverage
+	err := row.Scan(&b.ID, &b.Name, &b.Color, &b.HydrationFactor, &b.CaffeinePerServing, &b.servingML, &b.ArchivedAt, &b.CreatedAt)
+	return b, err
+}
+
+// loadCustomBeverage returns a drink of the user for logging. Archived drinks
+// are only accepted when allowArchived is set, i.e. for entries logged before.
+func loadCustomBeverage(q rowQuerier, userID, id string, allowArchived bool) (CustomBeverage, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return CustomBeverage{}, errUnknownCustomBeverage
+	}
+	b, err := scanCustomBeverage(q.QueryRow("SELECT "+customBeverageColumns+" FROM custom_beverages WHERE id = $1 AND user_id = $2",
+		id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return b, errUnknownCustomBeverage
+	}
+	if err == nil && b.ArchivedAt != nil && !allowArchived {
+		return b, errArchivedCustomBeverage
+	}
+	return b, err
+}
+
+func (b CustomBeverage) beverage() internal.Beverage {
+	return internal.CustomBeverage{
+		ID:                 b.ID,
+		Name:               b.Name,
+		HydrationFactor:    b.HydrationFactor,
+		CaffeinePerServing: b.CaffeinePerServing,
+		ServingML:          b.servingML,
+	}.Beverage()
+}
+
+func (b *CustomBeverage) setUnit(u units.Unit) {
+	b.Serving = u.FromML(b.servingML)
+	b.Unit = string(u)
+}
+
+// servingAmount converts the serving of a request to milliliters, answering
+// 400 for servings that are too large.
+func servingAmount(c *gin.Context, unit units.Unit, serving float64) (int, bool) {
+	ml, ok := toML(c, unit, serving, "serving")
+	if ok && ml > maxServingML {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("serving must not exceed %d ml", maxServingML)})
+		return 0, false
+	}
+	return ml, ok
+}
+
+// customBeverageID returns the :id path parameter, answering 404 when it isn't a UUID.
+func customBeverageID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Custom beverage not found"})
+		return "", false
+	}
+	return id, true
+}
+
+// respondWithCustomBeverage writes the drink in unit or the error of the query
+// that changed it, with the given success status.
+func respondWithCustomBeverage(c *gin.Context, status int, b CustomBeverage, unit units.Unit, err error, failure string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Custom beverage not found"})
+		return
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "You already have a drink with this name"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: failure})
+		return
+	}
+	b.setUnit(unit)
+	c.JSON(status, b)
+}
+
+// GetCustomBeverages godoc
+// @Summary      Get custom drinks / Получить свои напитки
+// @Description  Drinks defined by the user, archived ones only with include_archived=true / Напитки пользователя, архивные — с include_archived=true
+// @Tags         beverages
+// @Produce      json
+// @Param        include_archived  query  bool  false  "Include archived drinks / Включить архивные"
+// @Param        unit  query  string  false  "Unit of servings, defaults to the profile unit / Единица объёма"
+// @Success      200   {array}   CustomBeverage
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/custom-beverages [get]
+func getCustomBeverages(c *gin.Context) {
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	query := "SELECT " + customBeverageColumns + " FROM custom_beverages WHERE user_id = $1"
+	if c.Query("include_archived") != "true" {
+		query += " AND archived_at IS NULL"
+	}
+	rows, err := db.Query(query+" ORDER BY lower(name)", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch custom beverages"})
+		return
+	}
+	defer rows.Close()
+
+	beverages := make([]CustomBeverage, 0)
+	for rows.Next() {
+		b, err := scanCustomBeverage(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch custom beverages"})
+			return
+		}
+		b.setUnit(unit)
+		beverages = append(beverages, b)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch custom beverages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, beverages)
+}
+
+// CreateCustomBeverage godoc
+// @Summary      Create custom drink / Создать свой напиток
+// @Description  Define a drink to log entries against with custom_beverage_id / Создать напиток для записей с custom_beverage_id
+// @Tags         beverages
+// @Accept       json
+// @Produce      json
+// @Param        data  body  CreateCustomBeverageRequest  true  "Drink / Напиток"
+// @Success      201   {object}  CustomBeverage
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      409   {object}  ErrorResponse  "A drink with this name exists"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/custom-beverages [post]
+func createCustomBeverage(c *gin.Context) {
+	var req CreateCustomBeverageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Color == "" {
+		req.Color = defaultBeverageColor
+	}
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, req.Unit)
+	if !ok {
+		return
+	}
+	servingML, ok := servingAmount(c, unit, req.Serving)
+	if !ok {
+		return
+	}
+
+	b, err := scanCustomBeverage(db.QueryRow(`INSERT INTO custom_beverages
+		(id, user_id, name, color, hydration_factor, caffeine_mg_per_serving, serving_ml)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+customBeverageColumns,
+		uuid.New().String(), userID, req.Name, req.Color, *req.HydrationFactor, req.CaffeinePerServing, servingML))
+	respondWithCustomBeverage(c, http.StatusCreated, b, unit, err, "Failed to create custom beverage")
+}
+
+// UpdateCustomBeverage godoc
+// @Summary      Update custom drink / Изменить свой напиток
+// @Description  Change a custom drink or restore it from the archive. Entries logged before keep their effective amount / Изменить напиток или вернуть его из архива
+// @Tags         beverages
+// @Accept       json
+// @Produce      json
+// @Param        id    path  string                       true  "Drink ID / ID напитка"
+// @Param        data  body  UpdateCustomBeverageRequest  true  "Changes / Изменения"
+// @Success      200   {object}  CustomBeverage
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Custom beverage not found"
+// @Failure      409   {object}  ErrorResponse  "A drink with this name exists"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/custom-beverages/{id} [patch]
+func updateCustomBeverage(c *gin.Context) {
+	id, ok := customBeverageID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateCustomBeverageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req == (UpdateCustomBeverageRequest{}) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Nothing to update"})
+		return
+	}
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, req.Unit)
+	if !ok {
+		return
+	}
+	var servingML *int
+	if req.Serving != nil {
+		ml, ok := servingAmount(c, unit, *req.Serving)
+		if !ok {
+			return
+		}
+		servingML = &ml
+	}
+
+	b, err := scanCustomBeverage(db.QueryRow(`UPDATE custom_beverages SET
+			name = COALESCE($3, name),
+			color = COALESCE($4, color),
+			hydration_factor = COALESCE($5, hydration_factor),
+			caffeine_mg_per_serving = COALESCE($6, caffeine_mg_per_serving),
+			serving_ml = COALESCE($7, serving_ml),
+			archived_at = CASE WHEN $8::boolean IS NULL THEN archived_at
+				WHEN $8 THEN COALESCE(archived_at, CURRENT_TIMESTAMP) END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2
+		RETURNING `+customBeverageColumns,
+		id, userID, req.Name, req.Color, req.HydrationFactor, req.CaffeinePerServing, servingML, req.Archived))
+	respondWithCustomBeverage(c, http.StatusOK, b, unit, err, "Failed to update custom beverage")
+}
+
+// ArchiveCustomBeverage godoc
+// @Summary      Archive custom drink / Архивировать свой напиток
+// @Description  Hide a custom drink from logging. Its entries and stats are kept / Скрыть напиток, записи о нём сохраняются
+// @Tags         beverages
+// @Produce      json
+// @Param        id   path  string  true  "Drink ID / ID напитка"
+// @Success      200   {object}  CustomBeverage  "Archived drink"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Custom beverage not found"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/custom-beverages/{id} [delete]
+func archiveCustomBeverage(c *gin.Context) {
+	id, ok := customBeverageID(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	b, err := scanCustomBeverage(db.QueryRow(`UPDATE custom_beverages
+		SET archived_at = COALESCE(archived_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2
+		RETURNING `+customBeverageColumns, id, userID))
+	respondWithCustomBeverage(c, http.StatusOK, b, unit, err, "Failed to archive custom beverage")
+}
+
+// loadDrinkTotals sums the entries in [from, to) per catalog beverage and
+// custom drink, largest amount first.
+func loadDrinkTotals(userID string, from, to time.Time, unit units.Unit) ([]DrinkTotal, error) {
+	rows, err := db.Query(`SELECT e.type, e.custom_beverage_id, COALESCE(b.name, ''), COALESCE(b.color, ''),
+			COUNT(*), SUM(e.amount), SUM(e.effective_amount)
+		FROM hydration_entries e
+		LEFT JOIN custom_beverages b ON b.id = e.custom_beverage_id
+		WHERE e.user_id = $1 AND e.timestamp >= $2 AND e.timestamp < $3
+		GROUP BY e.type, e.custom_beverage_id, b.name, b.color
+		ORDER BY SUM(e.amount) DESC, e.type`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drinks := make([]DrinkTotal, 0)
+	for rows.Next() {
+		var d DrinkTotal
+		var amount, effective int
+		if err := rows.Scan(&d.Type, &d.CustomBeverageID, &d.Name, &d.Color, &d.Count, &amount, &effective); err != nil {
+			return nil, err
+		}
+		d.Amount = unit.FromML(amount)
+		d.EffectiveAmount = unit.FromML(effective)
+		if d.CustomBeverageID == nil {
+			// Types logged before the catalog are shown as they were entered
+			d.Name = d.Type
+			if b, ok := internal.LookupBeverage(d.Type); ok {
+				d.Name = b.Name
+			}
+		}
+		drinks = append(drinks, d)
+	}
+	return drinks, rows.Err()
+}
@@ -0,0 +1,299 @@
+package hydration
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"hydration-tracking/internal/units"
+	"hydration-tracking/services/hydration/internal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type UpdateEntryRequest struct {
+	Amount *float64 `json:"amount" binding:"omitempty,gt=0" example:"250"`
+	// Unit of amount and of the response, defaults to the unit in the user's profile
+	Unit string  `json:"unit" example:"ml"`
+	Type *string `json:"type" binding:"omitempty,min=1" example:"water"`
+	// CustomBeverageID switches the entry to a custom drink, Type to a catalog one
+	CustomBeverageID *string    `json:"custom_beverage_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Timestamp        *time.Time `json:"timestamp" example:"2024-01-15T10:30:00Z"`
+}
+
+const entryColumns = "id, user_id, amount, effective_amount, timestamp, type, custom_beverage_id"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// entryTimeError explains why a client-supplied timestamp was rejected.
+func entryTimeError(err error) string {
+	if errors.Is(err, internal.ErrTimestampTooOld) {
+		return fmt.Sprintf("timestamp must be within the last %s", entryMaxBackdate)
+	}
+	return "timestamp must not be in the future"
+}
+
+func scanEntry(row rowScanner) (HydrationEntry, error) {
+	var entry HydrationEntry
+	err := row.Scan(&entry.ID, &entry.UserID, &entry.amountML, &entry.effectiveML, &entry.Timestamp, &entry.Type, &entry.CustomBeverageID)
+	return entry, err
+}
+
+// setUnit fills the shown amounts from the stored milliliters.
+func (e *HydrationEntry) setUnit(u units.Unit) {
+	e.Amount = u.FromML(e.amountML)
+	e.EffectiveAmount = u.FromML(e.effectiveML)
+	e.Unit = string(u)
+}
+
+// customBeverageError answers 400 for drinks that can't be logged and
+// reports whether it did.
+func customBeverageError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, errUnknownCustomBeverage):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Unknown custom_beverage_id"})
+	case errors.Is(err, errArchivedCustomBeverage):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "The custom beverage is archived"})
+	default:
+		return false
+	}
+	return true
+}
+
+// entryID returns the :id path parameter, answering 404 when it isn't a UUID.
+func entryID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Entry not found"})
+		return "", false
+	}
+	return id, true
+}
+
+// respondWithEntry writes the entry in unit or the error of the query that
+// loaded it. Entries of other users are reported as missing.
+func respondWithEntry(c *gin.Context, entry HydrationEntry, unit units.Unit, err error, failure string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Entry not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: failure})
+		return
+	}
+	entry.setUnit(unit)
+	c.JSON(http.StatusOK, entry)
+}
+
+// GetEntry godoc
+// @Summary      Get hydration entry / Получить запись
+// @Description  Get a hydration entry of the user by id / Получить запись пользователя по id
+// @Tags         hydration
+// @Produce      json
+// @Param        id    path   string  true   "Entry ID / ID записи"
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {object}  HydrationEntry
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Entry not found"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/entries/{id} [get]
+func getEntry(c *gin.Context) {
+	id, ok := entryID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	entry, err := scanEntry(db.QueryRow("SELECT "+entryColumns+" FROM hydration_entries WHERE id = $1 AND user_id = $2",
+		id, userID))
+	respondWithEntry(c, entry, unit, err, "Failed to fetch entry")
+}
+
+// UpdateEntry godoc
+// @Summary      Update hydration entry / Изменить запись
+// @Description  Change the amount, drink and/or time of an entry / Изменить объём, напиток и/или время записи
+// @Tags         hydration
+// @Accept       json
+// @Produce      json
+// @Param        id    path  string              true  "Entry ID / ID записи"
+// @Param        data  body  UpdateEntryRequest  true  "Changes / Изменения"
+// @Success      200   {object}  HydrationEntry
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Entry not found"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/entries/{id} [patch]
+func updateEntry(c *gin.Context) {
+	id, ok := entryID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Amount == nil && req.Type == nil && req.CustomBeverageID == nil && req.Timestamp == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Nothing to update"})
+		return
+	}
+	if req.Type != nil && req.CustomBeverageID != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Provide either type or custom_beverage_id"})
+		return
+	}
+	if req.Type != nil {
+		if _, ok := internal.LookupBeverage(*req.Type); !ok {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: unknownBeverageError})
+			return
+		}
+	}
+
+	var timestamp time.Time
+	if req.Timestamp != nil {
+		resolved, err := internal.ResolveEntryTime(req.Timestamp, time.Now(), entryMaxBackdate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: entryTimeError(err)})
+			return
+		}
+		timestamp = resolved
+	}
+
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, req.Unit)
+	if !ok {
+		return
+	}
+	var amountML int
+	if req.Amount != nil {
+		if amountML, ok = toML(c, unit, *req.Amount, "amount"); !ok {
+			return
+		}
+	}
+
+	// The effective amount depends on both the amount and the type, so the
+	// entry is read and rewritten under a row lock
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update entry"})
+		return
+	}
+	defer tx.Rollback()
+
+	entry, err := scanEntry(tx.QueryRow("SELECT "+entryColumns+" FROM hydration_entries WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		id, userID))
+	if err != nil {
+		respondWithEntry(c, entry, unit, err, "Failed to update entry")
+		return
+	}
+
+	if req.Amount != nil {
+		entry.amountML = amountML
+	}
+	if req.Type != nil {
+		entry.Type = *req.Type
+		entry.CustomBeverageID = nil
+	}
+	if req.Timestamp != nil {
+		entry.Timestamp = timestamp
+	}
+
+	if req.CustomBeverageID != nil {
+		entry.Type = internal.CustomBeverageType
+		entry.CustomBeverageID = req.CustomBeverageID
+	}
+	if entry.CustomBeverageID != nil {
+		// An entry may stay on an archived drink but not be moved to one
+		custom, err := loadCustomBeverage(tx, userID, *entry.CustomBeverageID, req.CustomBeverageID == nil)
+		if customBeverageError(c, err) {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update entry"})
+			return
+		}
+		entry.effectiveML = custom.beverage().EffectiveAmount(entry.amountML)
+	} else {
+		entry.effectiveML = internal.EffectiveAmount(entry.amountML, entry.Type)
+	}
+
+	_, err = tx.Exec("UPDATE hydration_entries SET amount = $2, effective_amount = $3, type = $4, custom_beverage_id = $5, timestamp = $6 WHERE id = $1",
+		entry.ID, entry.amountML, entry.effectiveML, entry.Type, entry.CustomBeverageID, entry.Timestamp)
+	if err == nil {
+		err = tx.Commit()
+	}
+	respondWithEntry(c, entry, unit, err, "Failed to update entry")
+}
+
+// DeleteEntry godoc
+// @Summary      Delete hydration entry / Удалить запись
+// @Description  Delete an entry of the user / Удалить запись пользователя
+// @Tags         hydration
+// @Produce      json
+// @Param        id    path   string  true   "Entry ID / ID записи"
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {object}  HydrationEntry  "Deleted entry"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Entry not found"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/entries/{id} [delete]
+func deleteEntry(c *gin.Context) {
+	id, ok := entryID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	entry, err := scanEntry(db.QueryRow("DELETE FROM hydration_entries WHERE id = $1 AND user_id = $2 RETURNING "+entryColumns,
+		id, userID))
+	respondWithEntry(c, entry, unit, err, "Failed to delete entry")
+}
+
+// UndoLastEntry godoc
+// @Summary      Undo last entry / Отменить последнюю запись
+// @Description  Delete the most recently added entry of the user, e.g. after a mistaken quick-add / Удалить последнюю добавленную запись
+// @Tags         hydration
+// @Produce      json
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {object}  HydrationEntry  "Deleted entry"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "No entries to undo"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/entries/undo [post]
+func undoLastEntry(c *gin.Context) {
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	// Order by creation, not by timestamp: the last tap is what gets undone
+	entry, err := scanEntry(db.QueryRow(`DELETE FROM hydration_entries
+		WHERE id = (
+			SELECT id FROM hydration_entries WHERE user_id = $1
+			ORDER BY created_at DESC, timestamp DESC LIMIT 1
+		) AND user_id = $1
+		RETURNING `+entryColumns, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No entries to undo"})
+		return
+	}
+	respondWithEntry(c, entry, unit, err, "Failed to undo entry")
+}
@@ -0,0 +1,472 @@
+package hydration
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"hydration-tracking/internal/units"
+	"hydration-tracking/services/hydration/internal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ExerciseSession is a workout and the extra fluid it adds to the goal of the
+// day it started on. Amounts are stored in milliliters and shown in Unit.
+type ExerciseSession struct {
+	ID              string    `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Type            string    `json:"type" example:"running"`
+	StartedAt       time.Time `json:"started_at" example:"2024-07-15T07:00:00Z"`
+	DurationMinutes int       `json:"duration_minutes" example:"45"`
+	Intensity       string    `json:"intensity" example:"moderate"`
+	// SweatLoss is the measured loss, if the user entered one; otherwise it is estimated
+	SweatLoss  *float64 `json:"sweat_loss,omitempty" example:"900"`
+	ExtraFluid float64  `json:"extra_fluid" example:"750"`
+	Unit       string   `json:"unit" example:"ml"`
+	// IntakeWindows suggest when to drink ExtraFluid after the workout
+	IntakeWindows []IntakeWindow `json:"intake_windows"`
+
+	sweatLossML  *int
+	extraFluidML int
+}
+
+type IntakeWindow struct {
+	Start  time.Time `json:"start" example:"2024-07-15T07:45:00Z"`
+	End    time.Time `json:"end" example:"2024-07-15T08:15:00Z"`
+	Amount float64   `json:"amount" example:"400"`
+}
+
+type CreateExerciseSessionRequest struct {
+	// Type is running, cycling, walking, hiking, swimming, strength, team_sports, hiit, yoga or other
+	Type string `json:"type" binding:"required" example:"running"`
+	// StartedAt (RFC 3339) defaults to duration_minutes ago
+	StartedAt       *time.Time `json:"started_at" example:"2024-07-15T07:00:00Z"`
+	DurationMinutes int        `json:"duration_minutes" binding:"required,min=1,max=1440" example:"45"`
+	// Intensity is low, moderate (default) or high
+	Intensity string `json:"intensity" example:"moderate"`
+	// SweatLoss is a measured loss, e.g. from the weight before and after
+	SweatLoss *float64 `json:"sweat_loss" binding:"omitempty,gt=0" example:"900"`
+	// Unit of sweat_loss and of the response, defaults to the unit in the user's profile
+	Unit string `json:"unit" example:"ml"`
+}
+
+type UpdateExerciseSessionRequest struct {
+	Type            *string    `json:"type" example:"running"`
+	StartedAt       *time.Time `json:"started_at" example:"2024-07-15T07:00:00Z"`
+	DurationMinutes *int       `json:"duration_minutes" binding:"omitempty,min=1,max=1440" example:"45"`
+	Intensity       *string    `json:"intensity" example:"high"`
+	SweatLoss       *float64   `json:"sweat_loss" binding:"omitempty,gt=0" example:"900"`
+	Unit            string     `json:"unit" example:"ml"`
+}
+
+const exerciseColumns = "id, type, started_at, duration_minutes, intensity, sweat_loss, extra_fluid"
+
+// maxSweatLossML bounds a measured sweat loss; more is a typo, not a workout
+const maxSweatLossML = 10000
+
+// createExerciseSessionsTable stores workouts with the extra fluid computed
+// when they were saved, like the effective amount of an entry.
+func createExerciseSessionsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS exercise_sessions (
+		id UUID PRIMARY KEY,
+		user_id UUID NOT NULL,
+		type VARCHAR(32) NOT NULL,
+		started_at TIMESTAMPTZ NOT NULL,
+		duration_minutes INTEGER NOT NULL CHECK (duration_minutes > 0),
+		intensity VARCHAR(10) NOT NULL,
+		sweat_loss INTEGER CHECK (sweat_loss > 0),
+		extra_fluid INTEGER NOT NULL CHECK (extra_fluid >= 0),
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_exercise_sessions_user_started ON exercise_sessions(user_id, started_at);`)
+	return err
+}
+
+func scanExerciseSession(row rowScanner) (ExerciseSession, error) {
+	var s ExerciseSession
+	err := row.Scan(&s.ID, &s.Type, &s.StartedAt, &s.DurationMinutes, &s.Intensity, &s.sweatLossML, &s.extraFluidML)
+	return s, err
+}
+
+// computeExtraFluid sets the extra fluid from the measured sweat loss, or an
+// estimate when there is none.
+func (s *ExerciseSession) computeExtraFluid() {
+	loss := internal.EstimateSweatLoss(s.Type, s.Intensity, s.DurationMinutes)
+	if s.sweatLossML != nil {
+		loss = *s.sweatLossML
+	}
+	s.extraFluidML = internal.ExtraFluid(loss)
+}
+
+// setUnit fills the shown amounts and the intake windows from the stored milliliters.
+func (s *ExerciseSession) setUnit(u units.Unit) {
+	s.Unit = string(u)
+	s.ExtraFluid = u.FromML(s.extraFluidML)
+	if s.sweatLossML != nil {
+		loss := u.FromML(*s.sweatLossML)
+		s.SweatLoss = &loss
+	}
+	end := s.StartedAt.Add(time.Duration(s.DurationMinutes) * time.Minute)
+	s.IntakeWindows = make([]IntakeWindow, 0)
+	for _, w := range internal.IntakeWindows(end, s.extraFluidML) {
+		s.IntakeWindows = append(s.IntakeWindows, IntakeWindow{Start: w.Start, End: w.End, Amount: u.FromML(w.Amount)})
+	}
+}
+
+// exerciseSessionID returns the :id path parameter, answering 404 when it isn't a UUID.
+func exerciseSessionID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Exercise session not found"})
+		return "", false
+	}
+	return id, true
+}
+
+// respondWithExerciseSession writes the session in unit or the error of the query that loaded it.
+func respondWithExerciseSession(c *gin.Context, status int, s ExerciseSession, unit units.Unit, err error, failure string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Exercise session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: failure})
+		return
+	}
+	s.setUnit(unit)
+	c.JSON(status, s)
+}
+
+// checkExercise answers 400 for an unknown type or intensity.
+func checkExercise(c *gin.Context, exerciseType, intensity *string) bool {
+	if exerciseType != nil {
+		if err := internal.CheckExerciseType(*exerciseType); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return false
+		}
+	}
+	if intensity != nil {
+		if err := internal.CheckIntensity(*intensity); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+func exerciseStart(c *gin.Context, requested *time.Time) (time.Time, bool) {
+	started, err := internal.ResolveEntryTime(requested, time.Now(), entryMaxBackdate)
+	if errors.Is(err, internal.ErrTimestampTooOld) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("started_at must be within the last %s", entryMaxBackdate)})
+		return time.Time{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "started_at must not be in the future"})
+		return time.Time{}, false
+	}
+	return started, true
+}
+
+// sweatLossML converts a measured sweat loss to milliliters.
+func sweatLossML(c *gin.Context, unit units.Unit, amount float64) (int, bool) {
+	ml, ok := toML(c, unit, amount, "sweat_loss")
+	if ok && ml > maxSweatLossML {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("sweat_loss must not exceed %d ml", maxSweatLossML)})
+		return 0, false
+	}
+	return ml, ok
+}
+
+// GetExerciseSessions godoc
+// @Summary      Get exercise sessions / Получить тренировки
+// @Description  Workouts of the user, newest first, at most 200 / Тренировки пользователя, сначала новые
+// @Tags         exercise
+// @Produce      json
+// @Param        from  query  string  false  "Start, RFC 3339 time or YYYY-MM-DD in the user's timezone / Начало периода"
+// @Param        to    query  string  false  "End (inclusive), RFC 3339 time or YYYY-MM-DD / Конец периода"
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {array}   ExerciseSession
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid query"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/exercise-sessions [get]
+func getExerciseSessions(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	// Dates without a time are days in the user's timezone
+	var start, end *time.Time
+	if from, to := c.Query("from"), c.Query("to"); from != "" || to != "" {
+		loc := userLocation(userID)
+		if from != "" {
+			t, err := internal.ParseRangeStart(from, loc)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from must be an RFC 3339 time or YYYY-MM-DD"})
+				return
+			}
+			start = &t
+		}
+		if to != "" {
+			t, err := internal.ParseRangeEnd(to, loc)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "to must be an RFC 3339 time or YYYY-MM-DD"})
+				return
+			}
+			end = &t
+		}
+	}
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	rows, err := db.Query("SELECT "+exerciseColumns+` FROM exercise_sessions
+		WHERE user_id = $1
+			AND ($2::timestamptz IS NULL OR started_at >= $2)
+			AND ($3::timestamptz IS NULL OR started_at < $3)
+		ORDER BY started_at DESC, id DESC
+		LIMIT $4`, userID, start, end, maxEntryLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch exercise sessions"})
+		return
+	}
+	defer rows.Close()
+
+	sessions := make([]ExerciseSession, 0)
+	for rows.Next() {
+		s, err := scanExerciseSession(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch exercise sessions"})
+			return
+		}
+		s.setUnit(unit)
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch exercise sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// CreateExerciseSession godoc
+// @Summary      Log exercise session / Добавить тренировку
+// @Description  Log a workout. The sweat loss, measured or estimated from type, duration and intensity, × 1.25 rounded to 50 ml (at most 3000 ml) is added to the goal of the day the workout started on / Добавить тренировку; восполнение потерь с потом добавляется к цели дня
+// @Tags         exercise
+// @Accept       json
+// @Produce      json
+// @Param        data  body  CreateExerciseSessionRequest  true  "Workout / Тренировка"
+// @Success      201   {object}  ExerciseSession
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/exercise-sessions [post]
+func createExerciseSession(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req CreateExerciseSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Intensity == "" {
+		req.Intensity = "moderate"
+	}
+	if !checkExercise(c, &req.Type, &req.Intensity) {
+		return
+	}
+
+	// Without a start time the workout has just ended
+	if req.StartedAt == nil {
+		started := time.Now().Add(-time.Duration(req.DurationMinutes) * time.Minute)
+		req.StartedAt = &started
+	}
+	startedAt, ok := exerciseStart(c, req.StartedAt)
+	if !ok {
+		return
+	}
+
+	unit, ok := requestUnit(c, userID, req.Unit)
+	if !ok {
+		return
+	}
+	s := ExerciseSession{
+		ID:              uuid.New().String(),
+		Type:            req.Type,
+		StartedAt:       startedAt,
+		DurationMinutes: req.DurationMinutes,
+		Intensity:       req.Intensity,
+	}
+	if req.SweatLoss != nil {
+		ml, ok := sweatLossML(c, unit, *req.SweatLoss)
+		if !ok {
+			return
+		}
+		s.sweatLossML = &ml
+	}
+	s.computeExtraFluid()
+
+	_, err := db.Exec(`INSERT INTO exercise_sessions (id, user_id, type, started_at, duration_minutes, intensity, sweat_loss, extra_fluid)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		s.ID, userID, s.Type, s.StartedAt, s.DurationMinutes, s.Intensity, s.sweatLossML, s.extraFluidML)
+	respondWithExerciseSession(c, http.StatusCreated, s, unit, err, "Failed to save exercise session")
+}
+
+// GetExerciseSession godoc
+// @Summary      Get exercise session / Получить тренировку
+// @Tags         exercise
+// @Produce      json
+// @Param        id    path   string  true   "Exercise session ID / ID тренировки"
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {object}  ExerciseSession
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Exercise session not found"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/exercise-sessions/{id} [get]
+func getExerciseSession(c *gin.Context) {
+	id, ok := exerciseSessionID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	s, err := scanExerciseSession(db.QueryRow("SELECT "+exerciseColumns+" FROM exercise_sessions WHERE id = $1 AND user_id = $2",
+		id, userID))
+	respondWithExerciseSession(c, http.StatusOK, s, unit, err, "Failed to fetch exercise session")
+}
+
+// UpdateExerciseSession godoc
+// @Summary      Update exercise session / Изменить тренировку
+// @Description  Change a workout; its extra fluid is computed again / Изменить тренировку и пересчитать восполнение
+// @Tags         exercise
+// @Accept       json
+// @Produce      json
+// @Param        id    path  string  true  "Exercise session ID / ID тренировки"
+// @Param        data  body  UpdateExerciseSessionRequest  true  "Changed fields / Изменяемые поля"
+// @Success      200   {object}  ExerciseSession
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Exercise session not found"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/exercise-sessions/{id} [patch]
+func updateExerciseSession(c *gin.Context) {
+	id, ok := exerciseSessionID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateExerciseSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Type == nil && req.StartedAt == nil && req.DurationMinutes == nil && req.Intensity == nil && req.SweatLoss == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Nothing to update"})
+		return
+	}
+	if !checkExercise(c, req.Type, req.Intensity) {
+		return
+	}
+	var startedAt time.Time
+	if req.StartedAt != nil {
+		if startedAt, ok = exerciseStart(c, req.StartedAt); !ok {
+			return
+		}
+	}
+
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, req.Unit)
+	if !ok {
+		return
+	}
+	var lossML int
+	if req.SweatLoss != nil {
+		if lossML, ok = sweatLossML(c, unit, *req.SweatLoss); !ok {
+			return
+		}
+	}
+
+	// The extra fluid depends on every field, so the session is read and
+	// rewritten under a row lock
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update exercise session"})
+		return
+	}
+	defer tx.Rollback()
+
+	s, err := scanExerciseSession(tx.QueryRow("SELECT "+exerciseColumns+" FROM exercise_sessions WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		id, userID))
+	if err != nil {
+		respondWithExerciseSession(c, http.StatusOK, s, unit, err, "Failed to update exercise session")
+		return
+	}
+
+	if req.Type != nil {
+		s.Type = *req.Type
+	}
+	if req.StartedAt != nil {
+		s.StartedAt = startedAt
+	}
+	if req.DurationMinutes != nil {
+		s.DurationMinutes = *req.DurationMinutes
+	}
+	if req.Intensity != nil {
+		s.Intensity = *req.Intensity
+	}
+	if req.SweatLoss != nil {
+		s.sweatLossML = &lossML
+	}
+	s.computeExtraFluid()
+
+	_, err = tx.Exec(`UPDATE exercise_sessions SET type = $2, started_at = $3, duration_minutes = $4, intensity = $5,
+			sweat_loss = $6, extra_fluid = $7, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		s.ID, s.Type, s.StartedAt, s.DurationMinutes, s.Intensity, s.sweatLossML, s.extraFluidML)
+	if err == nil {
+		err = tx.Commit()
+	}
+	respondWithExerciseSession(c, http.StatusOK, s, unit, err, "Failed to update exercise session")
+}
+
+// DeleteExerciseSession godoc
+// @Summary      Delete exercise session / Удалить тренировку
+// @Tags         exercise
+// @Produce      json
+// @Param        id    path   string  true   "Exercise session ID / ID тренировки"
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {object}  ExerciseSession  "Deleted exercise session"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Exercise session not found"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/exercise-sessions/{id} [delete]
+func deleteExerciseSession(c *gin.Context) {
+	id, ok := exerciseSessionID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	s, err := scanExerciseSession(db.QueryRow("DELETE FROM exercise_sessions WHERE id = $1 AND user_id = $2 RETURNING "+exerciseColumns,
+		id, userID))
+	respondWithExerciseSession(c, http.StatusOK, s, unit, err, "Failed to delete exercise session")
+}
@@ -0,0 +1,130 @@
+package hydration
+
+import (
+	"net/http"
+	"time"
+
+	"hydration-tracking/services/hydration/internal"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GoalPeriod struct {
+	Goal          float64 `json:"goal" example:"2000"`
+	EffectiveFrom string  `json:"effective_from" example:"2024-01-15"`
+	// EffectiveTo is the last day of the period, empty for the current goal
+	EffectiveTo string `json:"effective_to,omitempty" example:"2024-02-01"`
+}
+
+type GoalHistoryResponse struct {
+	CurrentGoal float64      `json:"current_goal" example:"2000"`
+	Unit        string       `json:"unit" example:"ml"`
+	Goals       []GoalPeriod `json:"goals"`
+}
+
+// goalHistoryEpoch is the effective date of goals set before the history existed.
+const goalHistoryEpoch = "1970-01-01"
+
+// createGoalHistoryTable records every goal change with the day it took
+// effect, so past days keep the goal that applied to them.
+func createGoalHistoryTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS goal_history (
+		user_id UUID NOT NULL,
+		daily_goal INTEGER NOT NULL CHECK (daily_goal > 0),
+		effective_from DATE NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, effective_from),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO goal_history (user_id, daily_goal, effective_from)
+	SELECT g.user_id, g.daily_goal, DATE '` + goalHistoryEpoch + `' FROM user_goals g
+	WHERE NOT EXISTS (SELECT 1 FROM goal_history h WHERE h.user_id = g.user_id);`)
+	return err
+}
+
+// saveGoal makes goal the user's current goal from day on.
+func saveGoal(userID string, goal int, mode string, day time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO user_goals (user_id, daily_goal, goal_mode) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET daily_goal = $2, goal_mode = $3, updated_at = CURRENT_TIMESTAMP`,
+		userID, goal, mode)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO goal_history (user_id, daily_goal, effective_from) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, effective_from) DO UPDATE SET daily_goal = EXCLUDED.daily_goal, created_at = CURRENT_TIMESTAMP`,
+		userID, goal, internal.DateKey(day))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func loadGoalTimeline(userID string) (internal.GoalTimeline, error) {
+	rows, err := db.Query("SELECT effective_from, daily_goal FROM goal_history WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []internal.GoalChange
+	for rows.Next() {
+		var change internal.GoalChange
+		if err := rows.Scan(&change.EffectiveFrom, &change.Goal); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return internal.NewGoalTimeline(changes), nil
+}
+
+// GetGoalHistory godoc
+// @Summary      Get goal history / Получить историю целей
+// @Description  Daily goals of the user with the days they applied to / Дневные цели пользователя и периоды их действия
+// @Tags         hydration
+// @Produce      json
+// @Param        unit  query  string  false  "Unit of the goals, defaults to the profile's / Единица объёма"
+// @Success      200   {object}  GoalHistoryResponse
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Unknown unit"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/goal/history [get]
+func getGoalHistory(c *gin.Context) {
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	timeline, err := loadGoalTimeline(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch goal history"})
+		return
+	}
+
+	response := GoalHistoryResponse{
+		CurrentGoal: unit.FromML(internal.DefaultDailyGoal),
+		Unit:        string(unit),
+		Goals:       make([]GoalPeriod, 0, len(timeline)),
+	}
+	for i, change := range timeline {
+		period := GoalPeriod{Goal: unit.FromML(change.Goal), EffectiveFrom: internal.DateKey(change.EffectiveFrom)}
+		if i+1 < len(timeline) {
+			period.EffectiveTo = internal.DateKey(timeline[i+1].EffectiveFrom.AddDate(0, 0, -1))
+		}
+		response.Goals = append(response.Goals, period)
+		response.CurrentGoal = unit.FromML(change.Goal)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
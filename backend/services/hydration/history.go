@@ -0,0 +1,146 @@
+package hydration
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"hydration-tracking/services/hydration/internal"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HistoryBucket is one period of the history. Total is the effective
+// hydration the goal is judged by, Volume what was actually drunk.
+type HistoryBucket struct {
+	Start          string  `json:"start" example:"2024-01-15"`
+	End            string  `json:"end" example:"2024-01-21"`
+	Total          float64 `json:"total" example:"12500"`
+	Volume         float64 `json:"volume" example:"13400"`
+	Goal           float64 `json:"goal" example:"14000"`
+	GoalPercentage int     `json:"goal_percentage" example:"89"`
+	GoalMet        bool    `json:"goal_met" example:"false"`
+}
+
+type HistoryResponse struct {
+	Granularity string          `json:"granularity" example:"week"`
+	Timezone    string          `json:"timezone" example:"Asia/Vladivostok"`
+	Unit        string          `json:"unit" example:"ml"`
+	From        string          `json:"from" example:"2023-10-30"`
+	To          string          `json:"to" example:"2024-01-21"`
+	Buckets     []HistoryBucket `json:"buckets"`
+}
+
+// GetHistory godoc
+// @Summary      Get intake history / Получить историю потребления
+// @Description  Effective hydration and volume per day, ISO week or month in the user's timezone, with the goal of each period. Periods without entries are returned with zeros / Суммы по дням, неделям или месяцам с целью за период
+// @Tags         hydration
+// @Produce      json
+// @Param        from         query  string  false  "First day, YYYY-MM-DD (default: 30 days, 12 weeks or 12 months back) / Первый день"
+// @Param        to           query  string  false  "Last day, YYYY-MM-DD (default: today) / Последний день"
+// @Param        granularity  query  string  false  "day (default), week or month / Группировка"
+// @Param        unit         query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {object}  HistoryResponse
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid query"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/history [get]
+func getHistory(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	granularity, err := internal.ParseGranularity(c.Query("granularity"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	loc := userLocation(userID)
+	to := internal.BucketStart(time.Now().In(loc), internal.GranularityDay)
+	if value := c.Query("to"); value != "" {
+		if to, err = internal.ParseDate(value, loc); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "to must be a YYYY-MM-DD date"})
+			return
+		}
+	}
+	from := internal.DefaultHistoryStart(to, granularity)
+	if value := c.Query("from"); value != "" {
+		if from, err = internal.ParseDate(value, loc); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from must be a YYYY-MM-DD date"})
+			return
+		}
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from must not be after to"})
+		return
+	}
+	if to.Sub(from) > internal.MaxHistoryDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("The period must not exceed %d days", internal.MaxHistoryDays)})
+		return
+	}
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	// Sum per calendar day of the user's timezone, then bucket in Go
+	y, m, d := to.Date()
+	rows, err := db.Query(`SELECT (timestamp AT TIME ZONE $2)::date, SUM(amount), SUM(effective_amount)
+		FROM hydration_entries
+		WHERE user_id = $1 AND timestamp >= $3 AND timestamp < $4
+		GROUP BY 1`, userID, loc.String(), from, time.Date(y, m, d+1, 0, 0, 0, 0, loc))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch history"})
+		return
+	}
+	defer rows.Close()
+
+	totals := make(map[string]internal.DayTotal)
+	for rows.Next() {
+		var day time.Time
+		var total internal.DayTotal
+		if err := rows.Scan(&day, &total.Volume, &total.Effective); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch history"})
+			return
+		}
+		totals[internal.DateKey(day)] = total
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch history"})
+		return
+	}
+
+	goals, err := loadGoalTimeline(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch history"})
+		return
+	}
+	adjustments, err := loadGoalAdjustments(userID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch history"})
+		return
+	}
+	buckets := internal.BuildHistory(totals, from, to, granularity, goals.WithAdjustments(adjustments))
+
+	response := HistoryResponse{
+		Granularity: string(granularity),
+		Timezone:    loc.String(),
+		Unit:        string(unit),
+		From:        internal.DateKey(from),
+		To:          internal.DateKey(to),
+		Buckets:     make([]HistoryBucket, 0, len(buckets)),
+	}
+	for _, b := range buckets {
+		response.Buckets = append(response.Buckets, HistoryBucket{
+			Start:          internal.DateKey(b.Start),
+			End:            internal.DateKey(b.End),
+			Total:          unit.FromML(b.Total),
+			Volume:         unit.FromML(b.Volume),
+			Goal:           unit.FromML(b.Goal),
+			GoalPercentage: b.GoalPercentage,
+			GoalMet:        b.GoalMet,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
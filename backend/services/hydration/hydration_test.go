@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -46,3 +47,428 @@ func TestCreateEntry_Validation(t *testing.T) {
 		t.Errorf("ожидался статус 201 или 500 (если нет БД), получен %d", w.Code)
 	}
 }
+
+func TestCreateEntry_UnknownBeverage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/entries", func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+		createEntry(c)
+	})
+
+	body, _ := json.Marshal(mockCreateEntryRequest{Amount: 250, Type: "вода"})
+	req, _ := http.NewRequest("POST", "/entries", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("ожидался статус 400, получен %d", w.Code)
+	}
+}
+
+func TestGetBeverages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/beverages", getBeverages)
+
+	req, _ := http.NewRequest("GET", "/beverages", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("ожидался статус 200, получен %d", w.Code)
+	}
+
+	var beverages []Beverage
+	if err := json.Unmarshal(w.Body.Bytes(), &beverages); err != nil {
+		t.Fatalf("некорректный ответ: %v", err)
+	}
+	if len(beverages) == 0 || beverages[0].ID != "water" || beverages[0].HydrationFactor != 1 {
+		t.Errorf("каталог должен начинаться с воды, получено %+v", beverages)
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("email_unverified", true)
+	}, requireVerifiedEmail())
+	r.GET("/stats", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/entries", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	req, _ := http.NewRequest("GET", "/stats", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("ожидался статус 200 для чтения, получен %d", w.Code)
+	}
+
+	req, _ = http.NewRequest("POST", "/entries", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("ожидался статус 403 для записи, получен %d", w.Code)
+	}
+}
+
+func TestUpdateEntry_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.PATCH("/entries/:id", func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+		updateEntry(c)
+	})
+
+	tests := []struct {
+		name string
+		id   string
+		body string
+		want int
+	}{
+		{"нечего обновлять", "550e8400-e29b-41d4-a716-446655440000", `{}`, http.StatusBadRequest},
+		{"нулевой объём", "550e8400-e29b-41d4-a716-446655440000", `{"amount":0}`, http.StatusBadRequest},
+		{"пустой тип", "550e8400-e29b-41d4-a716-446655440000", `{"type":""}`, http.StatusBadRequest},
+		{"тип не из каталога", "550e8400-e29b-41d4-a716-446655440000", `{"type":"вода"}`, http.StatusBadRequest},
+		{"некорректный id", "not-a-uuid", `{"amount":250}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PATCH", "/entries/"+tt.id, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("ожидался статус %d, получен %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestCreateEntry_Timestamp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/entries", func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+		createEntry(c)
+	})
+
+	tests := []struct {
+		name      string
+		timestamp string
+	}{
+		{"будущее время", time.Now().Add(time.Hour).Format(time.RFC3339)},
+		{"слишком давно", time.Now().Add(-entryMaxBackdate - time.Hour).Format(time.RFC3339)},
+		{"не RFC 3339", "15.01.2024 10:30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"amount":250,"type":"water","timestamp":"` + tt.timestamp + `"}`
+			req, _ := http.NewRequest("POST", "/entries", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("ожидался статус 400, получен %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestGetEntries_QueryValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/entries", func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+		getEntries(c)
+	})
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=201",
+		"limit=abc",
+		"order=sideways",
+		"cursor=not-a-cursor",
+	} {
+		t.Run(query, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/entries?"+query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("ожидался статус 400, получен %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestGetHistory_InvalidGranularity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/history", func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+		getHistory(c)
+	})
+
+	req, _ := http.NewRequest("GET", "/history?granularity=year", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("ожидался статус 400, получен %d", w.Code)
+	}
+}
+
+func TestCustomBeverage_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+	})
+	r.POST("/custom-beverages", createCustomBeverage)
+	r.PATCH("/custom-beverages/:id", updateCustomBeverage)
+	r.POST("/entries", createEntry)
+
+	const id = "550e8400-e29b-41d4-a716-446655440000"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"нет коэффициента", "POST", "/custom-beverages", `{"name":"Oat latte","serving":300}`, http.StatusBadRequest},
+		{"коэффициент больше 1.5", "POST", "/custom-beverages", `{"name":"Oat latte","hydration_factor":2,"serving":300}`, http.StatusBadRequest},
+		{"некорректный цвет", "POST", "/custom-beverages", `{"name":"Oat latte","color":"brown","hydration_factor":0.85,"serving":300}`, http.StatusBadRequest},
+		{"неизвестная единица порции", "POST", "/custom-beverages", `{"name":"Oat latte","hydration_factor":0.85,"serving":10,"unit":"liter"}`, http.StatusBadRequest},
+		{"слишком большая порция", "POST", "/custom-beverages", `{"name":"Oat latte","hydration_factor":0.85,"serving":2500,"unit":"ml"}`, http.StatusBadRequest},
+		{"нет порции", "POST", "/custom-beverages", `{"name":"Oat latte","hydration_factor":0.85}`, http.StatusBadRequest},
+		{"нечего обновлять", "PATCH", "/custom-beverages/" + id, `{}`, http.StatusBadRequest},
+		{"некорректный id", "PATCH", "/custom-beverages/not-a-uuid", `{"name":"Latte"}`, http.StatusNotFound},
+		{"тип и свой напиток", "POST", "/entries", `{"amount":250,"type":"water","custom_beverage_id":"` + id + `"}`, http.StatusBadRequest},
+		{"ни типа, ни напитка", "POST", "/entries", `{"amount":250}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("ожидался статус %d, получен %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestPresets_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+	})
+	r.POST("/presets", createPreset)
+	r.PATCH("/presets/:id", updatePreset)
+	r.PUT("/presets/order", reorderPresets)
+	r.POST("/presets/:id/log", logPreset)
+
+	const id = "550e8400-e29b-41d4-a716-446655440000"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"нет названия", "POST", "/presets", `{"amount":750,"type":"water"}`, http.StatusBadRequest},
+		{"нет объёма", "POST", "/presets", `{"name":"Бутылка","type":"water"}`, http.StatusBadRequest},
+		{"тип не из каталога", "POST", "/presets", `{"name":"Бутылка","amount":750,"type":"вода"}`, http.StatusBadRequest},
+		{"неизвестная иконка", "POST", "/presets", `{"name":"Бутылка","amount":750,"type":"water","icon":"rocket"}`, http.StatusBadRequest},
+		{"нечего обновлять", "PATCH", "/presets/" + id, `{}`, http.StatusBadRequest},
+		{"тип и свой напиток", "PATCH", "/presets/" + id, `{"type":"water","custom_beverage_id":"` + id + `"}`, http.StatusBadRequest},
+		{"некорректный id", "PATCH", "/presets/not-a-uuid", `{"name":"Кружка"}`, http.StatusNotFound},
+		{"нет списка", "PUT", "/presets/order", `{}`, http.StatusBadRequest},
+		{"запись по некорректному id", "POST", "/presets/not-a-uuid/log", ``, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("ожидался статус %d, получен %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestUnits_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+	})
+	r.POST("/entries", createEntry)
+	r.GET("/entries", getEntries)
+	r.POST("/presets", createPreset)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"неизвестная единица", "POST", "/entries", `{"amount":250,"type":"water","unit":"liter"}`},
+		{"лишние знаки для унций", "POST", "/entries", `{"amount":8.25,"type":"water","unit":"fl_oz_us"}`},
+		{"лишние знаки для стаканов", "POST", "/entries", `{"amount":1.125,"type":"water","unit":"cup_us"}`},
+		{"дробные миллилитры", "POST", "/entries", `{"amount":250.5,"type":"water","unit":"ml"}`},
+		{"неизвестная единица в запросе", "GET", "/entries?unit=liter", ``},
+		{"пресет больше 5 литров", "POST", "/presets", `{"name":"Канистра","amount":200,"type":"water","unit":"fl_oz_uk"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("ожидался статус %d, получен %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestGoalRecommendation_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+	})
+	r.PUT("/body-profile", updateBodyProfile)
+	r.PUT("/goal", updateGoal)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"нет веса", "/body-profile", `{"age_band":"19-30","sex":"female","activity_level":"light"}`},
+		{"вес вне диапазона", "/body-profile", `{"weight_kg":500,"age_band":"19-30","sex":"female","activity_level":"light"}`},
+		{"неизвестная возрастная группа", "/body-profile", `{"weight_kg":70,"age_band":"20-29","sex":"female","activity_level":"light"}`},
+		{"неизвестная активность", "/body-profile", `{"weight_kg":70,"age_band":"19-30","sex":"female","activity_level":"extreme"}`},
+		{"беременность у мужчины", "/body-profile", `{"weight_kg":70,"age_band":"19-30","sex":"male","activity_level":"light","pregnant":true}`},
+		{"нет цели", "/goal", `{}`},
+		{"неизвестный режим", "/goal", `{"mode":"smart"}`},
+		{"цель в режиме auto", "/goal", `{"goal":2500,"mode":"auto"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PUT", tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("ожидался статус %d, получен %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestUpdateLocation_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+	})
+	r.PUT("/location", updateLocation)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"нет долготы", `{"latitude":43.1}`},
+		{"широта вне диапазона", `{"latitude":91,"longitude":131.9}`},
+		{"долгота вне диапазона", `{"latitude":43.1,"longitude":-181}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PUT", "/location", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("ожидался статус %d, получен %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestExerciseSessions_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", "test-user-id")
+	})
+	r.GET("/exercise-sessions", getExerciseSessions)
+	r.POST("/exercise-sessions", createExerciseSession)
+	r.PATCH("/exercise-sessions/:id", updateExerciseSession)
+	r.DELETE("/exercise-sessions/:id", deleteExerciseSession)
+
+	const id = "550e8400-e29b-41d4-a716-446655440000"
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"нет длительности", "POST", "/exercise-sessions", `{"type":"running"}`, http.StatusBadRequest},
+		{"слишком долгая", "POST", "/exercise-sessions", `{"type":"running","duration_minutes":1500}`, http.StatusBadRequest},
+		{"неизвестный вид", "POST", "/exercise-sessions", `{"type":"chess","duration_minutes":60}`, http.StatusBadRequest},
+		{"неизвестная интенсивность", "POST", "/exercise-sessions", `{"type":"running","duration_minutes":60,"intensity":"extreme"}`, http.StatusBadRequest},
+		{"начало в будущем", "POST", "/exercise-sessions", `{"type":"running","duration_minutes":60,"started_at":"` + future + `"}`, http.StatusBadRequest},
+		{"потеря с потом слишком велика", "POST", "/exercise-sessions", `{"type":"running","duration_minutes":60,"sweat_loss":20000,"unit":"ml"}`, http.StatusBadRequest},
+		{"нечего обновлять", "PATCH", "/exercise-sessions/" + id, `{}`, http.StatusBadRequest},
+		{"некорректный id", "PATCH", "/exercise-sessions/not-a-uuid", `{"duration_minutes":30}`, http.StatusNotFound},
+		{"удаление по некорректному id", "DELETE", "/exercise-sessions/not-a-uuid", ``, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("ожидался статус %d, получен %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestClaimWeatherAttempt(t *testing.T) {
+	now := time.Date(2024, 7, 15, 9, 0, 0, 0, time.UTC)
+	key := "test-user-id/2024-07-15"
+
+	if !claimWeatherAttempt(key, now) {
+		t.Fatal("первая попытка должна быть разрешена")
+	}
+	if claimWeatherAttempt(key, now.Add(time.Minute)) {
+		t.Error("повторная попытка раньше weatherRetryAfter должна быть отклонена")
+	}
+	if !claimWeatherAttempt("other-user-id/2024-07-15", now) {
+		t.Error("попытка другого пользователя должна быть разрешена")
+	}
+	if !claimWeatherAttempt(key, now.Add(weatherRetryAfter)) {
+		t.Error("попытка после weatherRetryAfter должна быть разрешена")
+	}
+}
+
+func TestHasAdjustment(t *testing.T) {
+	adjustments := []GoalAdjustment{{Source: adjustmentSourceExercise}}
+	if hasAdjustment(adjustments, adjustmentSourceWeather) {
+		t.Error("поправка по погоде не записана")
+	}
+	adjustments = append(adjustments, GoalAdjustment{Source: adjustmentSourceWeather})
+	if !hasAdjustment(adjustments, adjustmentSourceWeather) {
+		t.Error("поправка по погоде должна быть найдена")
+	}
+}
@@ -0,0 +1,102 @@
+package internal
+
+// EarlyBirdHour — записи до этого часа по времени пользователя считаются ранними
+const EarlyBirdHour = 8
+
+// AchievementStats — сводка по всем записям пользователя, по которой
+// проверяются достижения
+type AchievementStats struct {
+	Entries int
+	// VolumeML — всего выпито, мл
+	VolumeML  int
+	Beverages int
+	// EarlyBirdDays — дни с записью до EarlyBirdHour
+	EarlyBirdDays int
+	LongestStreak int
+	GoalDays      int
+}
+
+// Metric — показатель AchievementStats, по которому проверяется достижение
+type Metric int
+
+const (
+	MetricEntries Metric = iota
+	MetricVolume
+	MetricBeverages
+	MetricEarlyBirdDays
+	MetricLongestStreak
+	MetricGoalDays
+)
+
+// FromStreak сообщает, считается ли метрика по выполнению цели. Для неё
+// нужен пересчёт всей серии, а меняется она, только когда день впервые
+// выполняет цель.
+func (m Metric) FromStreak() bool {
+	return m == MetricLongestStreak || m == MetricGoalDays
+}
+
+func (s AchievementStats) value(m Metric) int {
+	switch m {
+	case MetricEntries:
+		return s.Entries
+	case MetricVolume:
+		return s.VolumeML
+	case MetricBeverages:
+		return s.Beverages
+	case MetricEarlyBirdDays:
+		return s.EarlyBirdDays
+	case MetricLongestStreak:
+		return s.LongestStreak
+	case MetricGoalDays:
+		return s.GoalDays
+	}
+	return 0
+}
+
+// Achievement — правило достижения: оно открывается, когда Metric из
+// AchievementStats достигает Target.
+type Achievement struct {
+	ID          string
+	Name        string
+	Description string
+	Target      int
+	Metric      Metric
+}
+
+var achievements = []Achievement{
+	{"first_entry", "First sip", "Log your first drink", 1, MetricEntries},
+	{"entries_100", "Habit", "Log 100 drinks", 100, MetricEntries},
+	{"streak_7", "Week strong", "Meet your goal 7 days in a row", 7, MetricLongestStreak},
+	{"streak_30", "Month strong", "Meet your goal 30 days in a row", 30, MetricLongestStreak},
+	{"goal_days_50", "Well watered", "Meet your goal on 50 days", 50, MetricGoalDays},
+	{"volume_100l", "100 liters", "Drink 100 liters in total", 100000, MetricVolume},
+	{"volume_1000l", "1000 liters", "Drink 1000 liters in total", 1000000, MetricVolume},
+	{"beverages_5", "Taster", "Try 5 different drinks", 5, MetricBeverages},
+	{"early_bird", "Early bird", "Log a drink before 8 am on 7 days", 7, MetricEarlyBirdDays},
+}
+
+// Achievements возвращает все достижения в порядке показа
+func Achievements() []Achievement {
+	return append([]Achievement(nil), achievements...)
+}
+
+// Progress — значение метрики, не больше Target
+func (a Achievement) Progress(s AchievementStats) int {
+	return min(s.value(a.Metric), a.Target)
+}
+
+func (a Achievement) Unlocked(s AchievementStats) bool {
+	return s.value(a.Metric) >= a.Target
+}
+
+// UnlockedAchievements возвращает ID достижений, условия которых выполнены.
+// Результат зависит только от s, поэтому повторная проверка безопасна.
+func UnlockedAchievements(s AchievementStats) []string {
+	var ids []string
+	for _, a := range achievements {
+		if a.Unlocked(s) {
+			ids = append(ids, a.ID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnlockedAchievements(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats AchievementStats
+		want  []string
+	}{
+		{"нет записей", AchievementStats{}, nil},
+		{"первая запись", AchievementStats{Entries: 1, VolumeML: 250, Beverages: 1}, []string{"first_entry"}},
+		{"неделя и пять напитков", AchievementStats{Entries: 30, VolumeML: 14000, Beverages: 5, LongestStreak: 7, GoalDays: 7},
+			[]string{"first_entry", "streak_7", "beverages_5"}},
+		{"100 литров и ранние записи", AchievementStats{Entries: 400, VolumeML: 100000, EarlyBirdDays: 7},
+			[]string{"first_entry", "entries_100", "volume_100l", "early_bird"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnlockedAchievements(tt.stats); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnlockedAchievements() = %v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAchievementProgress(t *testing.T) {
+	stats := AchievementStats{VolumeML: 250000}
+	for _, a := range Achievements() {
+		switch a.ID {
+		case "volume_100l":
+			if got := a.Progress(stats); got != a.Target {
+				t.Errorf("прогресс %s = %d, должен быть ограничен целью %d", a.ID, got, a.Target)
+			}
+		case "volume_1000l":
+			if got := a.Progress(stats); got != 250000 {
+				t.Errorf("прогресс %s = %d, ожидалось 250000", a.ID, got)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, a := range Achievements() {
+		if seen[a.ID] {
+			t.Errorf("ID достижения %q повторяется", a.ID)
+		}
+		seen[a.ID] = true
+	}
+}
+
+// После записи серию пересчитывают, только если этого требует FromStreak,
+// поэтому остальные достижения не должны от неё зависеть.
+func TestAchievementMetricFromStreak(t *testing.T) {
+	streakOnly := AchievementStats{LongestStreak: 1000, GoalDays: 1000}
+	for _, a := range Achievements() {
+		if got := a.Progress(streakOnly) > 0; got != a.Metric.FromStreak() {
+			t.Errorf("%s: зависимость от серии %v, FromStreak() = %v", a.ID, got, a.Metric.FromStreak())
+		}
+	}
+}
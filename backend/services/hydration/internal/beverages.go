@@ -0,0 +1,98 @@
+package internal
+
+import "math"
+
+// Beverage — напиток из каталога. HydrationFactor — доля объёма, которая
+// засчитывается в цель: кофеин и алкоголь усиливают диурез, поэтому чашка
+// кофе увлажняет меньше, чем стакан воды.
+type Beverage struct {
+	ID              string
+	Name            string
+	HydrationFactor float64
+	// CaffeinePer100ml — мг кофеина, SugarPer100ml — г сахара на 100 мл
+	CaffeinePer100ml float64
+	SugarPer100ml    float64
+}
+
+const (
+	// DefaultBeverage — тип записи по умолчанию и для записей, созданных до каталога
+	DefaultBeverage = "water"
+	// CustomBeverageType — тип записей о пользовательских напитках
+	CustomBeverageType = "custom"
+	// MaxHydrationFactor — верхняя граница коэффициента пользовательского
+	// напитка: столько дают молоко и растворы для регидратации
+	MaxHydrationFactor = 1.5
+)
+
+// beverages — каталог в порядке показа в приложении. ID хранятся в записях,
+// поэтому их нельзя переименовывать.
+var beverages = []Beverage{
+	{ID: "water", Name: "Water", HydrationFactor: 1.0},
+	{ID: "sparkling_water", Name: "Sparkling water", HydrationFactor: 1.0},
+	{ID: "tea", Name: "Tea", HydrationFactor: 0.9, CaffeinePer100ml: 20},
+	{ID: "herbal_tea", Name: "Herbal tea", HydrationFactor: 1.0},
+	{ID: "coffee", Name: "Coffee", HydrationFactor: 0.8, CaffeinePer100ml: 40},
+	{ID: "milk", Name: "Milk", HydrationFactor: 0.9, SugarPer100ml: 4.8},
+	{ID: "juice", Name: "Juice", HydrationFactor: 0.85, SugarPer100ml: 9},
+	{ID: "soda", Name: "Soda", HydrationFactor: 0.85, CaffeinePer100ml: 10, SugarPer100ml: 10.6},
+	{ID: "sports_drink", Name: "Sports drink", HydrationFactor: 1.0, SugarPer100ml: 6},
+	{ID: "energy_drink", Name: "Energy drink", HydrationFactor: 0.6, CaffeinePer100ml: 32, SugarPer100ml: 11},
+	{ID: "beer", Name: "Beer", HydrationFactor: 0.6, SugarPer100ml: 0.3},
+	{ID: "wine", Name: "Wine", HydrationFactor: 0.3, SugarPer100ml: 0.6},
+}
+
+var beverageIndex = func() map[string]Beverage {
+	index := make(map[string]Beverage, len(beverages))
+	for _, b := range beverages {
+		index[b.ID] = b
+	}
+	return index
+}()
+
+// Beverages возвращает копию каталога
+func Beverages() []Beverage {
+	return append([]Beverage(nil), beverages...)
+}
+
+func LookupBeverage(id string) (Beverage, bool) {
+	b, ok := beverageIndex[id]
+	return b, ok
+}
+
+// EffectiveAmount — сколько мл из amount засчитывается в цель
+func (b Beverage) EffectiveAmount(amount int) int {
+	return int(math.Round(float64(amount) * b.HydrationFactor))
+}
+
+// EffectiveAmount считает эффективный объём по ID напитка. Неизвестные типы
+// (записи до появления каталога) засчитываются как вода.
+func EffectiveAmount(amount int, beverageID string) int {
+	if b, ok := LookupBeverage(beverageID); ok {
+		return b.EffectiveAmount(amount)
+	}
+	return amount
+}
+
+// CustomBeverage — напиток, заведённый пользователем. Кофеин задаётся на
+// порцию ServingML, а не на 100 мл: так его проще взять с упаковки.
+type CustomBeverage struct {
+	ID                 string
+	Name               string
+	HydrationFactor    float64
+	CaffeinePerServing float64
+	ServingML          int
+}
+
+// Beverage приводит пользовательский напиток к виду записи каталога
+func (b CustomBeverage) Beverage() Beverage {
+	var caffeine float64
+	if b.ServingML > 0 {
+		caffeine = b.CaffeinePerServing * 100 / float64(b.ServingML)
+	}
+	return Beverage{
+		ID:               b.ID,
+		Name:             b.Name,
+		HydrationFactor:  b.HydrationFactor,
+		CaffeinePer100ml: caffeine,
+	}
+}
@@ -0,0 +1,53 @@
+package internal
+
+import "testing"
+
+func TestLookupBeverage(t *testing.T) {
+	if _, ok := LookupBeverage(DefaultBeverage); !ok {
+		t.Fatalf("напиток по умолчанию %q отсутствует в каталоге", DefaultBeverage)
+	}
+	if _, ok := LookupBeverage("вода"); ok {
+		t.Error("ожидалось, что произвольный тип не найден")
+	}
+
+	seen := make(map[string]bool)
+	for _, b := range Beverages() {
+		if seen[b.ID] {
+			t.Errorf("повторяющийся ID %q", b.ID)
+		}
+		seen[b.ID] = true
+		if b.HydrationFactor <= 0 || b.HydrationFactor > 1.5 {
+			t.Errorf("%s: HydrationFactor = %v вне допустимого диапазона", b.ID, b.HydrationFactor)
+		}
+	}
+}
+
+func TestEffectiveAmount(t *testing.T) {
+	tests := []struct {
+		amount   int
+		beverage string
+		want     int
+	}{
+		{250, "water", 250},
+		{250, "coffee", 200},
+		{333, "tea", 300},  // 299.7 округляется
+		{500, "вода", 500}, // старые записи засчитываются как вода
+		{330, "beer", 198},
+	}
+	for _, tt := range tests {
+		if got := EffectiveAmount(tt.amount, tt.beverage); got != tt.want {
+			t.Errorf("EffectiveAmount(%d, %q) = %d, want %d", tt.amount, tt.beverage, got, tt.want)
+		}
+	}
+}
+
+func TestCustomBeverage(t *testing.T) {
+	latte := CustomBeverage{ID: "oat-latte", Name: "Oat latte", HydrationFactor: 0.85, CaffeinePerServing: 75, ServingML: 300}
+	b := latte.Beverage()
+	if b.CaffeinePer100ml != 25 {
+		t.Errorf("CaffeinePer100ml = %v, want 25", b.CaffeinePer100ml)
+	}
+	if got := b.EffectiveAmount(latte.ServingML); got != 255 {
+		t.Errorf("EffectiveAmount(%d) = %d, want 255", latte.ServingML, got)
+	}
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Дополнительная жидкость за тренировку считается так:
+//
+//  1. потеря с потом — измеренная пользователем (например, по весу до и после)
+//     или оценка: потоотделение вида тренировки (мл/ч при средней
+//     интенсивности) × длительность × коэффициент интенсивности;
+//  2. × SweatReplacementFactor: потерю восполняют с запасом, потому что часть
+//     выпитого сразу выводится почками;
+//  3. округление до 50 мл и ограничение MaxExtraFluid на тренировку.
+const (
+	SweatReplacementFactor = 1.25
+	MaxExtraFluid          = 3000
+	extraFluidStep         = 50
+
+	MaxExerciseMinutes = 24 * 60
+)
+
+// sweatRates — потоотделение при средней интенсивности, мл/ч
+var sweatRates = map[string]int{
+	"running":     800,
+	"cycling":     600,
+	"walking":     300,
+	"hiking":      500,
+	"swimming":    400,
+	"strength":    400,
+	"team_sports": 700,
+	"hiit":        900,
+	"yoga":        250,
+	"other":       500,
+}
+
+var intensityFactors = map[string]float64{
+	"low":      0.6,
+	"moderate": 1.0,
+	"high":     1.4,
+}
+
+var (
+	ErrUnknownExercise  = errors.New("type must be running, cycling, walking, hiking, swimming, strength, team_sports, hiit, yoga or other")
+	ErrUnknownIntensity = errors.New("intensity must be low, moderate or high")
+)
+
+func CheckExerciseType(exerciseType string) error {
+	if _, ok := sweatRates[exerciseType]; !ok {
+		return ErrUnknownExercise
+	}
+	return nil
+}
+
+func CheckIntensity(intensity string) error {
+	if _, ok := intensityFactors[intensity]; !ok {
+		return ErrUnknownIntensity
+	}
+	return nil
+}
+
+// EstimateSweatLoss оценивает потерю с потом в мл для тренировки, прошедшей
+// CheckExerciseType и CheckIntensity.
+func EstimateSweatLoss(exerciseType, intensity string, minutes int) int {
+	loss := float64(sweatRates[exerciseType]) * float64(minutes) / 60 * intensityFactors[intensity]
+	return int(math.Round(loss))
+}
+
+// ExtraFluid — сколько выпить сверх дневной цели, чтобы восполнить sweatLoss мл.
+func ExtraFluid(sweatLoss int) int {
+	extra := float64(sweatLoss) * SweatReplacementFactor
+	ml := int(math.Round(extra/extraFluidStep)) * extraFluidStep
+	return min(ml, MaxExtraFluid)
+}
+
+// IntakeWindow — сколько выпить в промежутке после тренировки
+type IntakeWindow struct {
+	Start  time.Time
+	End    time.Time
+	Amount int
+}
+
+// intakeSchedule делит дополнительную жидкость после тренировки: половину
+// в первые 30 минут, пока жажда отстаёт от потерь, остальное — за 6 часов.
+var intakeSchedule = []struct {
+	from, to time.Duration
+	share    float64
+}{
+	{0, 30 * time.Minute, 0.5},
+	{30 * time.Minute, 2 * time.Hour, 0.3},
+	{2 * time.Hour, 6 * time.Hour, 0.2},
+}
+
+// IntakeWindows раскладывает extra мл по окнам после окончания тренировки end.
+// Объёмы округляются до 50 мл, остаток уходит в последнее окно, так что их
+// сумма равна extra. Окна без объёма пропускаются.
+func IntakeWindows(end time.Time, extra int) []IntakeWindow {
+	windows := make([]IntakeWindow, 0, len(intakeSchedule))
+	left := extra
+	for i, s := range intakeSchedule {
+		amount := left
+		if i < len(intakeSchedule)-1 {
+			amount = min(int(math.Round(float64(extra)*s.share/extraFluidStep))*extraFluidStep, left)
+		}
+		left -= amount
+		if amount > 0 {
+			windows = append(windows, IntakeWindow{Start: end.Add(s.from), End: end.Add(s.to), Amount: amount})
+		}
+	}
+	return windows
+}
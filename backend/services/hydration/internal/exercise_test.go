@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckExercise(t *testing.T) {
+	if err := CheckExerciseType("running"); err != nil {
+		t.Errorf("CheckExerciseType(running) = %v", err)
+	}
+	if err := CheckExerciseType("chess"); err != ErrUnknownExercise {
+		t.Errorf("CheckExerciseType(chess) = %v, ожидалось %v", err, ErrUnknownExercise)
+	}
+	if err := CheckIntensity("high"); err != nil {
+		t.Errorf("CheckIntensity(high) = %v", err)
+	}
+	if err := CheckIntensity("extreme"); err != ErrUnknownIntensity {
+		t.Errorf("CheckIntensity(extreme) = %v, ожидалось %v", err, ErrUnknownIntensity)
+	}
+}
+
+func TestExtraFluid(t *testing.T) {
+	tests := []struct {
+		name      string
+		sweatLoss int
+		want      int
+	}{
+		{"час бега", EstimateSweatLoss("running", "moderate", 60), 1000},
+		{"полчаса йоги", EstimateSweatLoss("yoga", "low", 30), 100},
+		{"интенсивная велотренировка", EstimateSweatLoss("cycling", "high", 90), 1600},
+		{"измеренная потеря", 1200, 1500},
+		{"не больше максимума", 4000, MaxExtraFluid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtraFluid(tt.sweatLoss); got != tt.want {
+				t.Errorf("ExtraFluid(%d) = %d, ожидалось %d", tt.sweatLoss, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntakeWindows(t *testing.T) {
+	end := time.Date(2024, 7, 15, 8, 0, 0, 0, time.UTC)
+	windows := IntakeWindows(end, 1050)
+
+	want := []int{550, 300, 200}
+	if len(windows) != len(want) {
+		t.Fatalf("получено %d окон, ожидалось %d", len(windows), len(want))
+	}
+	sum := 0
+	for i, w := range windows {
+		if w.Amount != want[i] {
+			t.Errorf("окно %d: %d мл, ожидалось %d", i, w.Amount, want[i])
+		}
+		sum += w.Amount
+	}
+	if sum != 1050 {
+		t.Errorf("сумма окон %d, ожидалось 1050", sum)
+	}
+	if !windows[0].Start.Equal(end) || !windows[2].End.Equal(end.Add(6*time.Hour)) {
+		t.Errorf("окна %s–%s, ожидалось с конца тренировки на 6 часов", windows[0].Start, windows[2].End)
+	}
+
+	// Малый объём целиком приходится на первое окно
+	if windows := IntakeWindows(end, 50); len(windows) != 1 || windows[0].Amount != 50 {
+		t.Errorf("IntakeWindows(50) = %+v, ожидалось одно окно на 50 мл", windows)
+	}
+	if windows := IntakeWindows(end, 0); len(windows) != 0 {
+		t.Errorf("IntakeWindows(0) = %+v, ожидалось без окон", windows)
+	}
+}
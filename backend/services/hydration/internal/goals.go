@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultDailyGoal — цель пользователей, которые её ещё не меняли
+const DefaultDailyGoal = 2000
+
+// GoalChange — цель, действующая с начала дня EffectiveFrom до следующего изменения
+type GoalChange struct {
+	EffectiveFrom time.Time
+	Goal          int
+}
+
+// GoalTimeline — история целей пользователя, упорядоченная по дате
+type GoalTimeline []GoalChange
+
+func NewGoalTimeline(changes []GoalChange) GoalTimeline {
+	timeline := append(GoalTimeline(nil), changes...)
+	sort.Slice(timeline, func(i, j int) bool {
+		return DateKey(timeline[i].EffectiveFrom) < DateKey(timeline[j].EffectiveFrom)
+	})
+	return timeline
+}
+
+// GoalOn возвращает цель, действовавшую в календарный день day. Даты
+// сравниваются как календарные, без учёта часового пояса. До первого
+// изменения действовала DefaultDailyGoal.
+func (t GoalTimeline) GoalOn(day time.Time) int {
+	key := DateKey(day)
+	// Первое изменение, вступившее в силу после day
+	i := sort.Search(len(t), func(i int) bool { return DateKey(t[i].EffectiveFrom) > key })
+	if i == 0 {
+		return DefaultDailyGoal
+	}
+	return t[i-1].Goal
+}
+
+// WithAdjustments возвращает цель дня вместе с надбавками за этот день
+// (например, за жару); adjustments — сумма надбавок в мл по DateKey.
+func (t GoalTimeline) WithAdjustments(adjustments map[string]int) func(day time.Time) int {
+	return func(day time.Time) int {
+		return t.GoalOn(day) + adjustments[DateKey(day)]
+	}
+}
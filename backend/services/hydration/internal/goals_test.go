@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoalTimeline(t *testing.T) {
+	date := func(value string) time.Time {
+		d, _ := time.Parse("2006-01-02", value)
+		return d
+	}
+	timeline := NewGoalTimeline([]GoalChange{
+		{EffectiveFrom: date("2024-01-15"), Goal: 2500},
+		{EffectiveFrom: date("2024-01-10"), Goal: 1800},
+	})
+
+	tests := []struct {
+		day  string
+		want int
+	}{
+		{"2024-01-09", DefaultDailyGoal},
+		{"2024-01-10", 1800},
+		{"2024-01-14", 1800},
+		{"2024-01-15", 2500},
+		{"2024-06-01", 2500},
+	}
+	for _, tt := range tests {
+		if got := timeline.GoalOn(date(tt.day)); got != tt.want {
+			t.Errorf("GoalOn(%s) = %d, want %d", tt.day, got, tt.want)
+		}
+	}
+
+	// День в поясе пользователя сравнивается по календарной дате
+	vladivostok := time.FixedZone("VLAT", 10*60*60)
+	if got := timeline.GoalOn(time.Date(2024, 1, 15, 0, 0, 0, 0, vladivostok)); got != 2500 {
+		t.Errorf("GoalOn(15 января во Владивостоке) = %d, want 2500", got)
+	}
+
+	if got := GoalTimeline(nil).GoalOn(date("2024-01-15")); got != DefaultDailyGoal {
+		t.Errorf("пустая история: GoalOn() = %d, want %d", got, DefaultDailyGoal)
+	}
+}
+
+func TestGoalTimeline_WithAdjustments(t *testing.T) {
+	day := time.Date(2024, 7, 15, 0, 0, 0, 0, time.UTC)
+	timeline := NewGoalTimeline([]GoalChange{{EffectiveFrom: day.AddDate(0, 0, -10), Goal: 2500}})
+	goalFor := timeline.WithAdjustments(map[string]int{DateKey(day): 400})
+
+	if got := goalFor(day); got != 2900 {
+		t.Errorf("цель в жаркий день = %d, ожидалось 2900", got)
+	}
+	if got := goalFor(day.AddDate(0, 0, 1)); got != 2500 {
+		t.Errorf("цель в день без надбавки = %d, ожидалось 2500", got)
+	}
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"errors"
+	"time"
+)
+
+type Granularity string
+
+const (
+	GranularityDay   Granularity = "day"
+	GranularityWeek  Granularity = "week"
+	GranularityMonth Granularity = "month"
+)
+
+// MaxHistoryDays ограничивает длину запрашиваемого периода истории
+const MaxHistoryDays = 731
+
+var ErrInvalidGranularity = errors.New("granularity must be day, week or month")
+
+func ParseGranularity(value string) (Granularity, error) {
+	switch g := Granularity(value); g {
+	case GranularityDay, GranularityWeek, GranularityMonth:
+		return g, nil
+	case "":
+		return GranularityDay, nil
+	default:
+		return "", ErrInvalidGranularity
+	}
+}
+
+// DateKey — ключ календарного дня (YYYY-MM-DD) в итогах по дням, которые принимает BuildHistory
+func DateKey(day time.Time) string {
+	return day.Format(dateLayout)
+}
+
+// ParseDate разбирает дату YYYY-MM-DD как полночь в поясе loc.
+func ParseDate(value string, loc *time.Location) (time.Time, error) {
+	day, err := time.ParseInLocation(dateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, ErrInvalidDate
+	}
+	return day, nil
+}
+
+// BucketStart возвращает первый день периода, в который попадает day:
+// сам день, понедельник его недели ISO 8601 или первое число месяца.
+func BucketStart(day time.Time, g Granularity) time.Time {
+	y, m, d := day.Date()
+	loc := day.Location()
+	switch g {
+	case GranularityWeek:
+		// time.Sunday == 0, а неделя ISO начинается с понедельника
+		offset := (int(day.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+	case GranularityMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+}
+
+// DefaultHistoryStart — начало периода по умолчанию, заканчивающегося в to:
+// 30 дней, 12 недель или 12 месяцев.
+func DefaultHistoryStart(to time.Time, g Granularity) time.Time {
+	switch g {
+	case GranularityWeek:
+		return BucketStart(to, g).AddDate(0, 0, -7*11)
+	case GranularityMonth:
+		return BucketStart(to, g).AddDate(0, -11, 0)
+	default:
+		return BucketStart(to, g).AddDate(0, 0, -29)
+	}
+}
+
+// DayTotal — объём выпитого за день и засчитанный в цель объём
+type DayTotal struct {
+	Volume    int
+	Effective int
+}
+
+type HistoryBucket struct {
+	// Start и End — первый и последний (включительно) день периода
+	Start time.Time
+	End   time.Time
+	// Total — эффективный объём, по нему оценивается цель
+	Total          int
+	Volume         int
+	Goal           int
+	GoalPercentage int
+	GoalMet        bool
+}
+
+// BuildHistory группирует дневные суммы (ключ — DateKey) в периоды с from по
+// to включительно. Периоды на краях обрезаются по границам запроса. Цель
+// периода — сумма дневных целей его дней, goalFor возвращает цель на день.
+// Дни без записей дают нулевые периоды, а не пропуски.
+func BuildHistory(totals map[string]DayTotal, from, to time.Time, g Granularity, goalFor func(day time.Time) int) []HistoryBucket {
+	var buckets []HistoryBucket
+	y, m, d := from.Date()
+	loc := from.Location()
+	for i := 0; ; i++ {
+		// time.Date, а не Add(24h): в дни перевода часов сутки не равны 24 часам
+		day := time.Date(y, m, d+i, 0, 0, 0, 0, loc)
+		if day.After(to) {
+			break
+		}
+
+		start := BucketStart(day, g)
+		if len(buckets) == 0 || !start.Equal(BucketStart(buckets[len(buckets)-1].Start, g)) {
+			buckets = append(buckets, HistoryBucket{Start: day})
+		}
+		b := &buckets[len(buckets)-1]
+		b.End = day
+		total := totals[DateKey(day)]
+		b.Total += total.Effective
+		b.Volume += total.Volume
+		b.Goal += goalFor(day)
+	}
+
+	for i := range buckets {
+		b := &buckets[i]
+		if b.Goal > 0 {
+			b.GoalPercentage = b.Total * 100 / b.Goal
+		}
+		b.GoalMet = b.Goal > 0 && b.Total >= b.Goal
+	}
+	return buckets
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func constantGoal(goal int) func(time.Time) int {
+	return func(time.Time) int { return goal }
+}
+
+// waterTotals — дневные суммы, где весь объём засчитывается в цель
+func waterTotals(volumes map[string]int) map[string]DayTotal {
+	totals := make(map[string]DayTotal, len(volumes))
+	for day, v := range volumes {
+		totals[day] = DayTotal{Volume: v, Effective: v}
+	}
+	return totals
+}
+
+func TestParseGranularity(t *testing.T) {
+	if g, err := ParseGranularity(""); err != nil || g != GranularityDay {
+		t.Errorf("ParseGranularity(\"\") = %v, %v; want day", g, err)
+	}
+	if _, err := ParseGranularity("year"); err == nil {
+		t.Error("ParseGranularity(\"year\") должен вернуть ошибку")
+	}
+}
+
+func TestBucketStart(t *testing.T) {
+	// 14 января 2024 года — воскресенье, неделя ISO началась 8 января
+	sunday := time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)
+	if got := BucketStart(sunday, GranularityWeek); DateKey(got) != "2024-01-08" {
+		t.Errorf("BucketStart(week) = %v, want 2024-01-08", DateKey(got))
+	}
+	monday := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	if got := BucketStart(monday, GranularityWeek); DateKey(got) != "2024-01-15" {
+		t.Errorf("BucketStart(week) = %v, want 2024-01-15", DateKey(got))
+	}
+	if got := BucketStart(sunday, GranularityMonth); DateKey(got) != "2024-01-01" {
+		t.Errorf("BucketStart(month) = %v, want 2024-01-01", DateKey(got))
+	}
+}
+
+func TestBuildHistory_Days(t *testing.T) {
+	from := time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	totals := waterTotals(map[string]int{"2024-01-13": 2500, "2024-01-15": 1000})
+
+	buckets := BuildHistory(totals, from, to, GranularityDay, constantGoal(2000))
+	if len(buckets) != 3 {
+		t.Fatalf("len(buckets) = %d, want 3", len(buckets))
+	}
+	want := []struct {
+		total, percent int
+		met            bool
+	}{
+		{2500, 125, true},
+		{0, 0, false}, // пустой день заполняется нулями
+		{1000, 50, false},
+	}
+	for i, w := range want {
+		b := buckets[i]
+		if b.Total != w.total || b.GoalPercentage != w.percent || b.GoalMet != w.met || b.Goal != 2000 {
+			t.Errorf("buckets[%d] = %+v, want total=%d percent=%d met=%v", i, b, w.total, w.percent, w.met)
+		}
+	}
+}
+
+func TestBuildHistory_WeeksAndMonths(t *testing.T) {
+	// Со среды 10 января по вторник 23 января: неполная неделя, полная и неполная
+	from := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 23, 0, 0, 0, 0, time.UTC)
+	totals := waterTotals(map[string]int{"2024-01-10": 1000, "2024-01-14": 500, "2024-01-15": 700, "2024-01-23": 300})
+
+	weeks := BuildHistory(totals, from, to, GranularityWeek, constantGoal(1000))
+	if len(weeks) != 3 {
+		t.Fatalf("len(weeks) = %d, want 3", len(weeks))
+	}
+	if DateKey(weeks[0].Start) != "2024-01-10" || DateKey(weeks[0].End) != "2024-01-14" {
+		t.Errorf("weeks[0] = %v..%v, want 2024-01-10..2024-01-14", DateKey(weeks[0].Start), DateKey(weeks[0].End))
+	}
+	if weeks[0].Total != 1500 || weeks[0].Goal != 5000 {
+		t.Errorf("weeks[0] total=%d goal=%d, want 1500 и 5000", weeks[0].Total, weeks[0].Goal)
+	}
+	if weeks[1].Total != 700 || weeks[1].Goal != 7000 {
+		t.Errorf("weeks[1] total=%d goal=%d, want 700 и 7000", weeks[1].Total, weeks[1].Goal)
+	}
+	if weeks[2].Total != 300 || weeks[2].Goal != 2000 {
+		t.Errorf("weeks[2] total=%d goal=%d, want 300 и 2000", weeks[2].Total, weeks[2].Goal)
+	}
+
+	months := BuildHistory(totals, time.Date(2023, 12, 30, 0, 0, 0, 0, time.UTC), to, GranularityMonth, constantGoal(100))
+	if len(months) != 2 || months[0].Goal != 200 || months[1].Total != 2500 {
+		t.Errorf("months = %+v", months)
+	}
+}
+
+func TestBuildHistory_DST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("нет базы часовых поясов: %v", err)
+	}
+	from := time.Date(2024, 3, 9, 0, 0, 0, 0, newYork)
+	to := time.Date(2024, 3, 11, 0, 0, 0, 0, newYork)
+	buckets := BuildHistory(waterTotals(map[string]int{"2024-03-10": 500}), from, to, GranularityDay, constantGoal(1000))
+	if len(buckets) != 3 || buckets[1].Total != 500 || DateKey(buckets[2].Start) != "2024-03-11" {
+		t.Errorf("buckets = %+v", buckets)
+	}
+}
+
+func TestBuildHistory_Effective(t *testing.T) {
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	totals := map[string]DayTotal{"2024-01-15": {Volume: 2200, Effective: 1900}}
+
+	buckets := BuildHistory(totals, day, day, GranularityDay, constantGoal(2000))
+	// Выпито больше цели, но засчитано меньше — цель не выполнена
+	if len(buckets) != 1 || buckets[0].Volume != 2200 || buckets[0].Total != 1900 || buckets[0].GoalMet {
+		t.Errorf("buckets = %+v", buckets)
+	}
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidDate   = errors.New("invalid date")
+)
+
+const dateLayout = "2006-01-02"
+
+// EncodeCursor кодирует позицию последней выданной записи для keyset-пагинации:
+// записи упорядочены по (timestamp, id), поэтому этой пары достаточно, чтобы
+// продолжить выборку без OFFSET.
+func EncodeCursor(timestamp time.Time, id string) string {
+	raw := timestamp.UTC().Format(time.RFC3339Nano) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor разбирает курсор, созданный EncodeCursor.
+func DecodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return timestamp, id, nil
+}
+
+// ParseRangeStart разбирает нижнюю границу фильтра: время RFC 3339 или дату
+// YYYY-MM-DD, которая означает полночь этого дня в поясе loc.
+func ParseRangeStart(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation(dateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, ErrInvalidDate
+	}
+	return day, nil
+}
+
+// ParseRangeEnd разбирает верхнюю границу фильтра и возвращает её как
+// исключающую: дата включает весь свой день, время — саму эту микросекунду.
+func ParseRangeEnd(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Truncate(time.Microsecond).Add(time.Microsecond), nil
+	}
+	day, err := time.ParseInLocation(dateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, ErrInvalidDate
+	}
+	y, m, d := day.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, loc), nil
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 1, 15, 10, 30, 0, 123456000, time.UTC)
+	cursor := EncodeCursor(ts, "550e8400-e29b-41d4-a716-446655440000")
+
+	gotTS, gotID, err := DecodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("DecodeCursor() error: %v", err)
+	}
+	if !gotTS.Equal(ts) || gotID != "550e8400-e29b-41d4-a716-446655440000" {
+		t.Errorf("DecodeCursor() = %v, %v", gotTS, gotID)
+	}
+
+	for _, bad := range []string{"", "!!!", EncodeCursor(ts, "")[:4], "MjAyNC0wMS0xNQ"} {
+		if _, _, err := DecodeCursor(bad); err == nil {
+			t.Errorf("DecodeCursor(%q) принял некорректный курсор", bad)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	vladivostok := time.FixedZone("VLAT", 10*60*60)
+
+	from, err := ParseRangeStart("2024-01-15", vladivostok)
+	if err != nil || !from.Equal(time.Date(2024, 1, 14, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseRangeStart(дата) = %v, %v", from, err)
+	}
+	to, err := ParseRangeEnd("2024-01-15", vladivostok)
+	if err != nil || !to.Equal(time.Date(2024, 1, 15, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseRangeEnd(дата) = %v, %v", to, err)
+	}
+
+	at := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	from, err = ParseRangeStart("2024-01-15T10:30:00Z", vladivostok)
+	if err != nil || !from.Equal(at) {
+		t.Errorf("ParseRangeStart(время) = %v, %v", from, err)
+	}
+	to, err = ParseRangeEnd("2024-01-15T10:30:00Z", vladivostok)
+	if err != nil || !to.Equal(at.Add(time.Microsecond)) {
+		t.Errorf("ParseRangeEnd(время) = %v, %v", to, err)
+	}
+
+	if _, err := ParseRangeStart("15.01.2024", vladivostok); err != ErrInvalidDate {
+		t.Errorf("ParseRangeStart() error = %v, want ErrInvalidDate", err)
+	}
+}
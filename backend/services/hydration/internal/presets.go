@@ -0,0 +1,48 @@
+package internal
+
+import "errors"
+
+// MaxPresets ограничивает число кнопок быстрого добавления у пользователя
+const MaxPresets = 20
+
+// DefaultPresetIcon — иконка пресета, если клиент её не выбрал
+const DefaultPresetIcon = "glass"
+
+// presetIcons — ключи иконок, которые умеют рисовать клиенты
+var presetIcons = map[string]bool{
+	"glass":         true,
+	"cup":           true,
+	"mug":           true,
+	"bottle":        true,
+	"sports_bottle": true,
+	"flask":         true,
+	"can":           true,
+	"carton":        true,
+	"teapot":        true,
+	"wine_glass":    true,
+}
+
+var ErrPresetOrder = errors.New("ids must list every preset exactly once")
+
+func ValidPresetIcon(icon string) bool {
+	return presetIcons[icon]
+}
+
+// CheckPresetOrder проверяет, что requested — перестановка existing:
+// новый порядок должен перечислять все пресеты пользователя ровно по разу.
+func CheckPresetOrder(existing, requested []string) error {
+	if len(existing) != len(requested) {
+		return ErrPresetOrder
+	}
+	pending := make(map[string]bool, len(existing))
+	for _, id := range existing {
+		pending[id] = true
+	}
+	for _, id := range requested {
+		if !pending[id] {
+			return ErrPresetOrder
+		}
+		delete(pending, id)
+	}
+	return nil
+}
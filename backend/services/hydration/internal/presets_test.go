@@ -0,0 +1,34 @@
+package internal
+
+import "testing"
+
+func TestValidPresetIcon(t *testing.T) {
+	if !ValidPresetIcon(DefaultPresetIcon) {
+		t.Errorf("иконка по умолчанию %q должна быть допустимой", DefaultPresetIcon)
+	}
+	if ValidPresetIcon("rocket") {
+		t.Error("ожидалось, что неизвестная иконка недопустима")
+	}
+}
+
+func TestCheckPresetOrder(t *testing.T) {
+	existing := []string{"a", "b", "c"}
+	tests := []struct {
+		name      string
+		requested []string
+		ok        bool
+	}{
+		{"перестановка", []string{"c", "a", "b"}, true},
+		{"не хватает пресета", []string{"a", "b"}, false},
+		{"повтор", []string{"a", "a", "b"}, false},
+		{"чужой пресет", []string{"a", "b", "d"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPresetOrder(existing, tt.requested)
+			if (err == nil) != tt.ok {
+				t.Errorf("CheckPresetOrder(%v) = %v", tt.requested, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"errors"
+	"math"
+)
+
+// Рекомендуемая дневная цель считается так:
+//
+//  1. вес (кг) × мл на кг для возрастной группы (AgeBand);
+//  2. × поправка на пол: female 0.9, other 0.95, male 1.0 — у женщин при том
+//     же весе меньше доля воды в теле;
+//  3. + надбавка за уровень активности (ActivityLevel);
+//  4. + 300 мл при беременности или 700 мл при кормлении грудью (берётся
+//     бо́льшая из надбавок, как в рекомендациях EFSA);
+//  5. округление до 50 мл и ограничение диапазоном MinRecommendedGoal..MaxRecommendedGoal.
+const (
+	MinRecommendedGoal = 1500
+	MaxRecommendedGoal = 5000
+	recommendationStep = 50
+
+	PregnancyExtra     = 300
+	BreastfeedingExtra = 700
+
+	MinWeightKg = 30
+	MaxWeightKg = 300
+)
+
+type AgeBand string
+
+const (
+	Age14to18 AgeBand = "14-18"
+	Age19to30 AgeBand = "19-30"
+	Age31to50 AgeBand = "31-50"
+	Age51to70 AgeBand = "51-70"
+	Age71Plus AgeBand = "71+"
+)
+
+// mlPerKg — мл воды на кг веса; с возрастом потребность на кг снижается
+var mlPerKg = map[AgeBand]float64{
+	Age14to18: 40,
+	Age19to30: 35,
+	Age31to50: 35,
+	Age51to70: 30,
+	Age71Plus: 25,
+}
+
+type Sex string
+
+const (
+	SexFemale Sex = "female"
+	SexMale   Sex = "male"
+	SexOther  Sex = "other"
+)
+
+var sexFactor = map[Sex]float64{
+	SexFemale: 0.9,
+	SexMale:   1.0,
+	SexOther:  0.95,
+}
+
+type ActivityLevel string
+
+const (
+	ActivitySedentary  ActivityLevel = "sedentary"
+	ActivityLight      ActivityLevel = "light"
+	ActivityModerate   ActivityLevel = "moderate"
+	ActivityActive     ActivityLevel = "active"
+	ActivityVeryActive ActivityLevel = "very_active"
+)
+
+// activityExtra — надбавка в мл на обычный для уровня активности день
+var activityExtra = map[ActivityLevel]int{
+	ActivitySedentary:  0,
+	ActivityLight:      250,
+	ActivityModerate:   500,
+	ActivityActive:     750,
+	ActivityVeryActive: 1000,
+}
+
+// BodyProfile — данные пользователя, из которых считается рекомендуемая цель
+type BodyProfile struct {
+	WeightKg      float64
+	AgeBand       AgeBand
+	Sex           Sex
+	Activity      ActivityLevel
+	Pregnant      bool
+	Breastfeeding bool
+}
+
+var (
+	ErrInvalidWeight   = errors.New("weight_kg must be between 30 and 300")
+	ErrInvalidAgeBand  = errors.New("age_band must be 14-18, 19-30, 31-50, 51-70 or 71+")
+	ErrInvalidSex      = errors.New("sex must be female, male or other")
+	ErrInvalidActivity = errors.New("activity_level must be sedentary, light, moderate, active or very_active")
+	ErrMalePregnancy   = errors.New("pregnant and breastfeeding do not apply to sex male")
+)
+
+func (p BodyProfile) Validate() error {
+	switch {
+	case p.WeightKg < MinWeightKg || p.WeightKg > MaxWeightKg:
+		return ErrInvalidWeight
+	case mlPerKg[p.AgeBand] == 0:
+		return ErrInvalidAgeBand
+	case sexFactor[p.Sex] == 0:
+		return ErrInvalidSex
+	}
+	if _, ok := activityExtra[p.Activity]; !ok {
+		return ErrInvalidActivity
+	}
+	if p.Sex == SexMale && (p.Pregnant || p.Breastfeeding) {
+		return ErrMalePregnancy
+	}
+	return nil
+}
+
+// Recommendation — рекомендуемая цель и слагаемые, из которых она получена
+type Recommendation struct {
+	// Goal — итоговая цель после округления и ограничения диапазоном
+	Goal          int
+	Base          int
+	ActivityExtra int
+	// ReproductiveExtra — надбавка при беременности или кормлении грудью
+	ReproductiveExtra int
+}
+
+// Recommend считает цель по формуле из описания констант. Профиль должен
+// пройти Validate.
+func Recommend(p BodyProfile) Recommendation {
+	r := Recommendation{
+		Base:          int(math.Round(p.WeightKg * mlPerKg[p.AgeBand] * sexFactor[p.Sex])),
+		ActivityExtra: activityExtra[p.Activity],
+	}
+	switch {
+	case p.Breastfeeding:
+		r.ReproductiveExtra = BreastfeedingExtra
+	case p.Pregnant:
+		r.ReproductiveExtra = PregnancyExtra
+	}
+
+	total := float64(r.Base + r.ActivityExtra + r.ReproductiveExtra)
+	goal := int(math.Round(total/recommendationStep)) * recommendationStep
+	r.Goal = min(max(goal, MinRecommendedGoal), MaxRecommendedGoal)
+	return r
+}
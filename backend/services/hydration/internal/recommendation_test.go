@@ -0,0 +1,67 @@
+package internal
+
+import "testing"
+
+func TestRecommend(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile BodyProfile
+		want    Recommendation
+	}{
+		{"мужчина 70 кг без нагрузки",
+			BodyProfile{WeightKg: 70, AgeBand: Age19to30, Sex: SexMale, Activity: ActivitySedentary},
+			Recommendation{Goal: 2450, Base: 2450}},
+		{"женщина 60 кг, умеренная активность",
+			BodyProfile{WeightKg: 60, AgeBand: Age31to50, Sex: SexFemale, Activity: ActivityModerate},
+			Recommendation{Goal: 2400, Base: 1890, ActivityExtra: 500}},
+		{"беременность",
+			BodyProfile{WeightKg: 60, AgeBand: Age19to30, Sex: SexFemale, Activity: ActivitySedentary, Pregnant: true},
+			Recommendation{Goal: 2200, Base: 1890, ReproductiveExtra: PregnancyExtra}},
+		{"кормление важнее беременности",
+			BodyProfile{WeightKg: 60, AgeBand: Age19to30, Sex: SexFemale, Activity: ActivitySedentary, Pregnant: true, Breastfeeding: true},
+			Recommendation{Goal: 2600, Base: 1890, ReproductiveExtra: BreastfeedingExtra}},
+		{"не меньше минимума",
+			BodyProfile{WeightKg: 40, AgeBand: Age71Plus, Sex: SexOther, Activity: ActivitySedentary},
+			Recommendation{Goal: MinRecommendedGoal, Base: 950}},
+		{"не больше максимума",
+			BodyProfile{WeightKg: 150, AgeBand: Age14to18, Sex: SexMale, Activity: ActivityVeryActive},
+			Recommendation{Goal: MaxRecommendedGoal, Base: 6000, ActivityExtra: 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.profile.Validate(); err != nil {
+				t.Fatalf("Validate() = %v", err)
+			}
+			if got := Recommend(tt.profile); got != tt.want {
+				t.Errorf("Recommend() = %+v, ожидалось %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBodyProfile_Validate(t *testing.T) {
+	valid := BodyProfile{WeightKg: 70, AgeBand: Age19to30, Sex: SexFemale, Activity: ActivityLight}
+	tests := []struct {
+		name   string
+		modify func(p *BodyProfile)
+		want   error
+	}{
+		{"слишком лёгкий", func(p *BodyProfile) { p.WeightKg = 20 }, ErrInvalidWeight},
+		{"неизвестная возрастная группа", func(p *BodyProfile) { p.AgeBand = "30-40" }, ErrInvalidAgeBand},
+		{"неизвестный пол", func(p *BodyProfile) { p.Sex = "x" }, ErrInvalidSex},
+		{"неизвестная активность", func(p *BodyProfile) { p.Activity = "extreme" }, ErrInvalidActivity},
+		{"беременность у мужчины", func(p *BodyProfile) { p.Sex = SexMale; p.Pregnant = true }, ErrMalePregnancy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid
+			tt.modify(&p)
+			if err := p.Validate(); err != tt.want {
+				t.Errorf("Validate() = %v, ожидалось %v", err, tt.want)
+			}
+		})
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v для корректного профиля", err)
+	}
+}
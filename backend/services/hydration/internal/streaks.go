@@ -0,0 +1,92 @@
+package internal
+
+import "time"
+
+const (
+	// FreezeEarnDays — сколько дней с выполненной целью подряд дают одну заморозку
+	FreezeEarnDays = 7
+	// MaxFreezes — сколько заморозок можно накопить
+	MaxFreezes = 2
+)
+
+// Streak — серия дней с выполненной целью. Замороженный день не прерывает
+// серию, но и не увеличивает её.
+type Streak struct {
+	Current int
+	Longest int
+	// MetDays — все дни с выполненной целью, в том числе вне серий
+	MetDays int
+	// Start — первый день текущей серии, нулевой при Current == 0
+	Start time.Time
+	// TodayMet — выполнена ли цель сегодня; пока день не кончился,
+	// невыполненная цель серию не прерывает
+	TodayMet         bool
+	FreezesAvailable int
+	// FrozenDays — дни текущей серии, пропуски которых покрыты заморозками
+	FrozenDays []time.Time
+	// DaysToNextFreeze — сколько ещё дней с выполненной целью до новой
+	// заморозки, 0 если накоплен максимум
+	DaysToNextFreeze int
+}
+
+// ReplayStreak проигрывает дни с from по today включительно (календарные дни
+// одного пояса) и считает серию. totals — эффективный объём по DateKey,
+// goalFor — цель на день. Результат зависит только от входных данных, так что
+// правка или удаление старых записей пересчитывает серию целиком.
+//
+// Каждые FreezeEarnDays дней с выполненной целью подряд дают заморозку, но не
+// больше MaxFreezes. Пропущенный день при непустой серии автоматически тратит
+// заморозку; без заморозок серия обнуляется вместе со счётчиком до следующей.
+func ReplayStreak(totals map[string]int, from, today time.Time, goalFor func(day time.Time) int) Streak {
+	var s Streak
+	earned := 0
+	y, m, d := from.Date()
+	loc := from.Location()
+	for i := 0; ; i++ {
+		// time.Date, а не Add(24h): в дни перевода часов сутки не равны 24 часам
+		day := time.Date(y, m, d+i, 0, 0, 0, 0, loc)
+		if day.After(today) {
+			break
+		}
+		isToday := DateKey(day) == DateKey(today)
+
+		goal := goalFor(day)
+		if goal > 0 && totals[DateKey(day)] >= goal {
+			if s.Current == 0 {
+				s.Start = day
+			}
+			s.MetDays++
+			s.Current++
+			if s.Current > s.Longest {
+				s.Longest = s.Current
+			}
+			s.TodayMet = isToday
+			earned++
+			if earned == FreezeEarnDays {
+				earned = 0
+				if s.FreezesAvailable < MaxFreezes {
+					s.FreezesAvailable++
+				}
+			}
+			continue
+		}
+
+		switch {
+		case isToday:
+			// День ещё не закончился
+		case s.Current > 0 && s.FreezesAvailable > 0:
+			s.FreezesAvailable--
+			s.FrozenDays = append(s.FrozenDays, day)
+		default:
+			s.Current = 0
+			s.Start = time.Time{}
+			s.FrozenDays = nil
+			earned = 0
+		}
+	}
+
+	if s.FreezesAvailable < MaxFreezes {
+		s.DaysToNextFreeze = FreezeEarnDays - earned
+	}
+	return s
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayStreak(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	goal := func(time.Time) int { return 2000 }
+	// days строит суммы по дням с from: true — цель выполнена
+	days := func(met ...bool) map[string]int {
+		totals := make(map[string]int)
+		for i, ok := range met {
+			if ok {
+				totals[DateKey(from.AddDate(0, 0, i))] = 2000
+			}
+		}
+		return totals
+	}
+	repeat := func(n int, met bool) []bool {
+		out := make([]bool, n)
+		for i := range out {
+			out[i] = met
+		}
+		return out
+	}
+	concat := func(parts ...[]bool) []bool {
+		var out []bool
+		for _, p := range parts {
+			out = append(out, p...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name           string
+		met            []bool
+		wantCurrent    int
+		wantLongest    int
+		wantFreezes    int
+		wantFrozen     int
+		wantTodayMet   bool
+		wantNextFreeze int
+	}{
+		{"нет записей", repeat(3, false), 0, 0, 0, 0, false, FreezeEarnDays},
+		{"три дня подряд", repeat(3, true), 3, 3, 0, 0, true, FreezeEarnDays - 3},
+		{"сегодня ещё не выполнена", concat(repeat(3, true), []bool{false}), 3, 3, 0, 0, false, FreezeEarnDays - 3},
+		{"пропуск без заморозки", concat(repeat(3, true), []bool{false}, repeat(2, true)), 2, 3, 0, 0, true, FreezeEarnDays - 2},
+		{"неделя даёт заморозку", repeat(7, true), 7, 7, 1, 0, true, FreezeEarnDays},
+		{"заморозка спасает пропуск", concat(repeat(7, true), []bool{false}, repeat(2, true)), 9, 9, 0, 1, true, FreezeEarnDays - 2},
+		{"заморозок не больше двух", repeat(21, true), 21, 21, MaxFreezes, 0, true, 0},
+		{"заморозки кончились", concat(repeat(14, true), repeat(3, false), []bool{true}), 1, 14, 0, 0, true, FreezeEarnDays - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			today := from.AddDate(0, 0, len(tt.met)-1)
+			s := ReplayStreak(days(tt.met...), from, today, goal)
+			if s.Current != tt.wantCurrent || s.Longest != tt.wantLongest {
+				t.Errorf("серия %d/%d, ожидалась %d/%d", s.Current, s.Longest, tt.wantCurrent, tt.wantLongest)
+			}
+			if s.FreezesAvailable != tt.wantFreezes || len(s.FrozenDays) != tt.wantFrozen {
+				t.Errorf("заморозки %d, потрачено %d, ожидалось %d и %d", s.FreezesAvailable, len(s.FrozenDays), tt.wantFreezes, tt.wantFrozen)
+			}
+			if s.TodayMet != tt.wantTodayMet {
+				t.Errorf("TodayMet = %v, ожидалось %v", s.TodayMet, tt.wantTodayMet)
+			}
+			if s.DaysToNextFreeze != tt.wantNextFreeze {
+				t.Errorf("DaysToNextFreeze = %d, ожидалось %d", s.DaysToNextFreeze, tt.wantNextFreeze)
+			}
+		})
+	}
+}
+
+func TestReplayStreak_GoalOfEachDay(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeline := NewGoalTimeline([]GoalChange{{EffectiveFrom: from.AddDate(0, 0, 2), Goal: 3000}})
+	totals := map[string]int{
+		DateKey(from):                  2000,
+		DateKey(from.AddDate(0, 0, 1)): 2000,
+		// С третьего дня цель выросла, 2500 уже мало
+		DateKey(from.AddDate(0, 0, 2)): 2500,
+		DateKey(from.AddDate(0, 0, 3)): 3000,
+	}
+	s := ReplayStreak(totals, from, from.AddDate(0, 0, 3), timeline.GoalOn)
+	if s.Current != 1 || s.Longest != 2 {
+		t.Errorf("серия %d/%d, ожидалась 1/2", s.Current, s.Longest)
+	}
+	if s.MetDays != 3 {
+		t.Errorf("MetDays = %d, ожидалось 3", s.MetDays)
+	}
+	if !s.Start.Equal(from.AddDate(0, 0, 3)) {
+		t.Errorf("Start = %s, ожидался %s", DateKey(s.Start), DateKey(from.AddDate(0, 0, 3)))
+	}
+}
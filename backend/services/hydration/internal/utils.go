@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"errors"
 	"time"
 )
 
@@ -12,55 +13,112 @@ type HydrationEntry struct {
 	Type      string
 }
 
+// HydrationStats — Total* считают объём выпитого, Effective* — засчитанный
+// в цель с учётом коэффициентов напитков.
 type HydrationStats struct {
 	TotalToday     int
 	TotalWeek      int
 	TotalMonth     int
+	EffectiveToday int
+	EffectiveWeek  int
+	EffectiveMonth int
 	Goal           int
 	GoalPercentage int
 }
 
-// CalculateStats рассчитывает статистику по записям
-func CalculateStats(entries []HydrationEntry, goal int) HydrationStats {
-	now := time.Now()
-	today := now.Format("2006-01-02")
-	weekAgo := now.AddDate(0, 0, -7)
-	monthAgo := now.AddDate(0, -1, 0)
+// StatsWindows — границы периодов статистики. Неделя — сегодня и шесть
+// предыдущих дней, месяц — с того же числа прошлого месяца. Все периоды
+// заканчиваются в DayEnd (полночь завтрашнего дня).
+type StatsWindows struct {
+	DayStart   time.Time
+	WeekStart  time.Time
+	MonthStart time.Time
+	DayEnd     time.Time
+}
 
-	totalToday := 0
-	totalWeek := 0
-	totalMonth := 0
+// WindowsAt строит периоды по календарю часового пояса now. Границы
+// считаются через time.Date, поэтому день перехода на летнее время длится
+// 23 или 25 часов, а не ровно 24.
+func WindowsAt(now time.Time) StatsWindows {
+	y, m, d := now.Date()
+	loc := now.Location()
+	return StatsWindows{
+		DayStart:   time.Date(y, m, d, 0, 0, 0, 0, loc),
+		WeekStart:  time.Date(y, m, d-6, 0, 0, 0, 0, loc),
+		MonthStart: time.Date(y, m-1, d, 0, 0, 0, 0, loc),
+		DayEnd:     time.Date(y, m, d+1, 0, 0, 0, 0, loc),
+	}
+}
+
+// Contains сообщает, попадает ли t в полуинтервал [from, w.DayEnd).
+func (w StatsWindows) Contains(from, t time.Time) bool {
+	return !t.Before(from) && t.Before(w.DayEnd)
+}
+
+// CalculateStats рассчитывает статистику по записям. Границы дней берутся
+// из часового пояса now — передавайте время в поясе пользователя.
+func CalculateStats(entries []HydrationEntry, goal int, now time.Time) HydrationStats {
+	w := WindowsAt(now)
+
+	stats := HydrationStats{Goal: goal}
 	for _, e := range entries {
-		if e.Timestamp.Format("2006-01-02") == today {
-			totalToday += e.Amount
+		effective := EffectiveAmount(e.Amount, e.Type)
+		if w.Contains(w.DayStart, e.Timestamp) {
+			stats.TotalToday += e.Amount
+			stats.EffectiveToday += effective
 		}
-		if e.Timestamp.After(weekAgo) {
-			totalWeek += e.Amount
+		if w.Contains(w.WeekStart, e.Timestamp) {
+			stats.TotalWeek += e.Amount
+			stats.EffectiveWeek += effective
 		}
-		if e.Timestamp.After(monthAgo) {
-			totalMonth += e.Amount
+		if w.Contains(w.MonthStart, e.Timestamp) {
+			stats.TotalMonth += e.Amount
+			stats.EffectiveMonth += effective
 		}
 	}
-	percent := 0
 	if goal > 0 {
-		percent = totalToday * 100 / goal
-	}
-	return HydrationStats{
-		TotalToday:     totalToday,
-		TotalWeek:      totalWeek,
-		TotalMonth:     totalMonth,
-		Goal:           goal,
-		GoalPercentage: percent,
+		stats.GoalPercentage = stats.EffectiveToday * 100 / goal
 	}
+	return stats
 }
 
-// ValidateEntry проверяет валидность данных для записи
+// ValidateEntry проверяет валидность данных для записи: тип должен быть
+// напитком из каталога
 func ValidateEntry(amount int, entryType string) bool {
 	if amount <= 0 {
 		return false
 	}
-	if entryType == "" {
-		return false
+	_, ok := LookupBeverage(entryType)
+	return ok
+}
+
+var (
+	ErrFutureTimestamp = errors.New("timestamp is in the future")
+	ErrTimestampTooOld = errors.New("timestamp is too old")
+)
+
+// MaxClockSkew — насколько часы клиента могут спешить относительно сервера
+const MaxClockSkew = time.Minute
+
+// ResolveEntryTime возвращает время, которое будет сохранено для записи:
+// now, если клиент время не передал, иначе переданное время в UTC с
+// точностью до микросекунд (как хранит PostgreSQL). Время из будущего
+// (с учётом MaxClockSkew) и старше maxAge отклоняется.
+func ResolveEntryTime(requested *time.Time, now time.Time, maxAge time.Duration) (time.Time, error) {
+	now = now.UTC().Truncate(time.Microsecond)
+	if requested == nil {
+		return now, nil
+	}
+
+	t := requested.UTC().Truncate(time.Microsecond)
+	if t.After(now.Add(MaxClockSkew)) {
+		return time.Time{}, ErrFutureTimestamp
+	}
+	if t.After(now) {
+		return now, nil
+	}
+	if now.Sub(t) > maxAge {
+		return time.Time{}, ErrTimestampTooOld
 	}
-	return true
+	return t, nil
 }
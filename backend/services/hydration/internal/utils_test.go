@@ -18,6 +18,9 @@ func TestValidateEntry(t *testing.T) {
 	if ValidateEntry(100, "") {
 		t.Error("Ожидалось false для пустого типа")
 	}
+	if ValidateEntry(100, "вода") {
+		t.Error("Ожидалось false для типа не из каталога")
+	}
 }
 
 func TestCalculateStats(t *testing.T) {
@@ -36,7 +39,7 @@ func TestCalculateStats(t *testing.T) {
 		tenDaysAgoEntry, // 10 дней назад
 	}
 	goal := 1000
-	stats := CalculateStats(entries, goal)
+	stats := CalculateStats(entries, goal, now)
 
 	if stats.TotalToday != 200 {
 		t.Errorf("TotalToday = %d, want 200", stats.TotalToday)
@@ -57,3 +60,106 @@ func TestCalculateStats(t *testing.T) {
 		t.Errorf("GoalPercentage = %d, want 20", stats.GoalPercentage)
 	}
 }
+
+func TestCalculateStats_Timezone(t *testing.T) {
+	vladivostok, err := time.LoadLocation("Asia/Vladivostok")
+	if err != nil {
+		t.Skipf("нет базы часовых поясов: %v", err)
+	}
+
+	// 09:00 16 января во Владивостоке — в UTC ещё 15 января
+	now := time.Date(2024, 1, 16, 9, 0, 0, 0, vladivostok)
+	entries := []HydrationEntry{
+		{Amount: 200, Timestamp: time.Date(2024, 1, 15, 15, 30, 0, 0, time.UTC)}, // 01:30 16 января по местному
+		{Amount: 300, Timestamp: time.Date(2024, 1, 15, 13, 30, 0, 0, time.UTC)}, // 23:30 15 января по местному
+	}
+	stats := CalculateStats(entries, 1000, now)
+	if stats.TotalToday != 200 {
+		t.Errorf("TotalToday = %d, want 200", stats.TotalToday)
+	}
+	if stats.TotalWeek != 500 {
+		t.Errorf("TotalWeek = %d, want 500", stats.TotalWeek)
+	}
+}
+
+func TestCalculateStats_Effective(t *testing.T) {
+	now := time.Date(2024, 1, 15, 18, 0, 0, 0, time.UTC)
+	entries := []HydrationEntry{
+		{Amount: 500, Type: "water", Timestamp: now.Add(-time.Hour)},
+		{Amount: 250, Type: "coffee", Timestamp: now.Add(-2 * time.Hour)},
+	}
+	stats := CalculateStats(entries, 1000, now)
+	if stats.TotalToday != 750 {
+		t.Errorf("TotalToday = %d, want 750", stats.TotalToday)
+	}
+	// Кофе засчитывается с коэффициентом 0.8: 500 + 200
+	if stats.EffectiveToday != 700 || stats.EffectiveMonth != 700 {
+		t.Errorf("EffectiveToday = %d, EffectiveMonth = %d, want 700", stats.EffectiveToday, stats.EffectiveMonth)
+	}
+	// Процент цели считается по эффективному объёму
+	if stats.GoalPercentage != 70 {
+		t.Errorf("GoalPercentage = %d, want 70", stats.GoalPercentage)
+	}
+}
+
+func TestWindowsAt_DST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("нет базы часовых поясов: %v", err)
+	}
+
+	// 10 марта 2024 года часы переводятся вперёд: в сутках 23 часа
+	w := WindowsAt(time.Date(2024, 3, 10, 12, 0, 0, 0, newYork))
+	if got := w.DayEnd.Sub(w.DayStart); got != 23*time.Hour {
+		t.Errorf("длительность дня = %v, want 23h", got)
+	}
+	if !w.Contains(w.DayStart, time.Date(2024, 3, 10, 23, 30, 0, 0, newYork)) {
+		t.Error("23:30 10 марта должно входить в сегодня")
+	}
+	if w.Contains(w.DayStart, time.Date(2024, 3, 9, 23, 30, 0, 0, newYork)) {
+		t.Error("23:30 9 марта не должно входить в сегодня")
+	}
+	if want := time.Date(2024, 3, 4, 0, 0, 0, 0, newYork); !w.WeekStart.Equal(want) {
+		t.Errorf("WeekStart = %v, want %v", w.WeekStart, want)
+	}
+
+	// 3 ноября 2024 года часы переводятся назад: в сутках 25 часов
+	w = WindowsAt(time.Date(2024, 11, 3, 12, 0, 0, 0, newYork))
+	if got := w.DayEnd.Sub(w.DayStart); got != 25*time.Hour {
+		t.Errorf("длительность дня = %v, want 25h", got)
+	}
+}
+
+func TestResolveEntryTime(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	maxAge := 7 * 24 * time.Hour
+	at := func(t time.Time) *time.Time { return &t }
+	moscow := time.FixedZone("MSK", 3*60*60)
+
+	tests := []struct {
+		name      string
+		requested *time.Time
+		want      time.Time
+		wantErr   error
+	}{
+		{"без времени", nil, now, nil},
+		{"час назад", at(now.Add(-time.Hour)), now.Add(-time.Hour), nil},
+		{"другой часовой пояс", at(time.Date(2024, 1, 15, 12, 0, 0, 0, moscow)), time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC), nil},
+		{"наносекунды отбрасываются", at(now.Add(-time.Hour + 1500)), now.Add(-time.Hour + time.Microsecond), nil},
+		{"спешащие часы клиента", at(now.Add(30 * time.Second)), now, nil},
+		{"будущее", at(now.Add(2 * time.Minute)), time.Time{}, ErrFutureTimestamp},
+		{"ровно maxAge", at(now.Add(-maxAge)), now.Add(-maxAge), nil},
+		{"старше maxAge", at(now.Add(-maxAge - time.Second)), time.Time{}, ErrTimestampTooOld},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveEntryTime(tt.requested, now, maxAge)
+			if err != tt.wantErr {
+				t.Fatalf("ResolveEntryTime() error = %v, want %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) || (err == nil && got.Location() != time.UTC) {
+				t.Errorf("ResolveEntryTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Package weather looks up the day's conditions and turns them into extra
+// water for the daily goal. The static provider lets the service and its
+// tests run offline.
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conditions are the weather of one calendar day at a location.
+type Conditions struct {
+	// MaxTempC is the highest temperature of the day in °C
+	MaxTempC float64 `json:"max_temp_c"`
+	// Humidity is the mean relative humidity in percent
+	Humidity float64 `json:"humidity"`
+}
+
+// Provider reports the conditions of a calendar day (YYYY-MM-DD) at a location.
+type Provider interface {
+	Daily(ctx context.Context, lat, lon float64, day string) (Conditions, error)
+}
+
+// StaticProvider reports the same conditions everywhere, every day.
+type StaticProvider struct {
+	Conditions Conditions
+}
+
+func (p StaticProvider) Daily(context.Context, float64, float64, string) (Conditions, error) {
+	return p.Conditions, nil
+}
+
+// HTTPProvider asks a weather service for
+//
+//	GET {BaseURL}/daily?lat=..&lon=..&date=YYYY-MM-DD
+//
+// which answers with Conditions as JSON, e.g. {"max_temp_c": 31.5, "humidity": 64}.
+type HTTPProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (p *HTTPProvider) Daily(ctx context.Context, lat, lon float64, day string) (Conditions, error) {
+	query := url.Values{}
+	query.Set("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+	query.Set("lon", strconv.FormatFloat(lon, 'f', -1, 64))
+	query.Set("date", day)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(p.BaseURL, "/")+"/daily?"+query.Encode(), nil)
+	if err != nil {
+		return Conditions{}, err
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Conditions{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Conditions{}, fmt.Errorf("weather service answered %s", resp.Status)
+	}
+
+	var c Conditions
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return Conditions{}, fmt.Errorf("decode weather: %w", err)
+	}
+	return c, nil
+}
+
+const (
+	// ComfortTempC is the highest temperature that needs no extra water.
+	ComfortTempC = 25
+	// MLPerDegree is the extra water per °C above ComfortTempC.
+	MLPerDegree = 100
+	// HumidThreshold is the relative humidity from which sweat evaporates
+	// poorly and the extra water grows by HumidFactor.
+	HumidThreshold = 70
+	HumidFactor    = 1.25
+	// MaxAdjustment caps the extra water of one day.
+	MaxAdjustment  = 1000
+	adjustmentStep = 50
+)
+
+// Adjustment returns the extra water in ml the conditions call for:
+// MLPerDegree for each °C above ComfortTempC, × HumidFactor at HumidThreshold
+// or more, rounded to 50 ml and capped at MaxAdjustment. Days at or below
+// ComfortTempC need nothing extra.
+func Adjustment(c Conditions) int {
+	if c.MaxTempC <= ComfortTempC {
+		return 0
+	}
+	extra := (c.MaxTempC - ComfortTempC) * MLPerDegree
+	if c.Humidity >= HumidThreshold {
+		extra *= HumidFactor
+	}
+	ml := int(math.Round(extra/adjustmentStep)) * adjustmentStep
+	return min(ml, MaxAdjustment)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// FromEnv selects the provider with WEATHER_PROVIDER ("none", "static" or
+// "http"). With "none" it returns a nil Provider and goals are not adjusted.
+func FromEnv() (Provider, error) {
+	switch kind := getEnv("WEATHER_PROVIDER", "none"); kind {
+	case "none":
+		return nil, nil
+	case "static":
+		temp, err := strconv.ParseFloat(getEnv("WEATHER_STATIC_TEMP_C", "20"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEATHER_STATIC_TEMP_C: %w", err)
+		}
+		humidity, err := strconv.ParseFloat(getEnv("WEATHER_STATIC_HUMIDITY", "50"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEATHER_STATIC_HUMIDITY: %w", err)
+		}
+		return StaticProvider{Conditions: Conditions{MaxTempC: temp, Humidity: humidity}}, nil
+	case "http":
+		baseURL := os.Getenv("WEATHER_BASE_URL")
+		if baseURL == "" {
+			return nil, fmt.Errorf("WEATHER_BASE_URL must be set for WEATHER_PROVIDER=http")
+		}
+		timeout, err := time.ParseDuration(getEnv("WEATHER_TIMEOUT", "3s"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEATHER_TIMEOUT: %w", err)
+		}
+		return &HTTPProvider{BaseURL: baseURL, Client: &http.Client{Timeout: timeout}}, nil
+	default:
+		return nil, fmt.Errorf("unknown WEATHER_PROVIDER %q", kind)
+	}
+}
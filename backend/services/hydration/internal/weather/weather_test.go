@@ -0,0 +1,82 @@
+package weather
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdjustment(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Conditions
+		want int
+	}{
+		{"cool day", Conditions{MaxTempC: 18, Humidity: 80}, 0},
+		{"comfort limit", Conditions{MaxTempC: ComfortTempC, Humidity: 50}, 0},
+		{"warm and dry", Conditions{MaxTempC: 30, Humidity: 40}, 500},
+		{"warm and humid", Conditions{MaxTempC: 30, Humidity: 75}, 650},
+		{"rounded to 50 ml", Conditions{MaxTempC: 27.3, Humidity: 40}, 250},
+		{"capped", Conditions{MaxTempC: 42, Humidity: 90}, MaxAdjustment},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Adjustment(tt.c); got != tt.want {
+				t.Errorf("Adjustment(%+v) = %d, want %d", tt.c, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/daily" || q.Get("lat") != "43.1155" || q.Get("lon") != "131.8855" || q.Get("date") != "2024-07-15" {
+			http.Error(w, "unexpected request "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"max_temp_c": 31.5, "humidity": 64}`))
+	}))
+	defer srv.Close()
+
+	p := &HTTPProvider{BaseURL: srv.URL + "/"}
+	c, err := p.Daily(context.Background(), 43.1155, 131.8855, "2024-07-15")
+	if err != nil {
+		t.Fatalf("Daily() error: %v", err)
+	}
+	if c != (Conditions{MaxTempC: 31.5, Humidity: 64}) {
+		t.Errorf("Daily() = %+v", c)
+	}
+
+	if _, err := p.Daily(context.Background(), 0, 0, "2024-07-15"); err == nil {
+		t.Error("Daily() accepted an error status")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("WEATHER_PROVIDER", "")
+	if p, err := FromEnv(); err != nil || p != nil {
+		t.Errorf("FromEnv() = %#v, %v, want no provider by default", p, err)
+	}
+
+	t.Setenv("WEATHER_PROVIDER", "static")
+	t.Setenv("WEATHER_STATIC_TEMP_C", "33")
+	p, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv() error: %v", err)
+	}
+	if sp, ok := p.(StaticProvider); !ok || sp.Conditions.MaxTempC != 33 {
+		t.Errorf("FromEnv() = %#v, want StaticProvider at 33 °C", p)
+	}
+
+	t.Setenv("WEATHER_PROVIDER", "http")
+	if _, err := FromEnv(); err == nil {
+		t.Error("FromEnv() accepted http without WEATHER_BASE_URL")
+	}
+
+	t.Setenv("WEATHER_PROVIDER", "almanac")
+	if _, err := FromEnv(); err == nil {
+		t.Error("FromEnv() accepted an unknown provider")
+	}
+}
@@ -0,0 +1,540 @@
+package hydration
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"hydration-tracking/internal/units"
+	"hydration-tracking/services/hydration/internal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Preset is a quick-add button: a named container of a drink. The amount is
+// stored in milliliters and shown in Unit.
+type Preset struct {
+	ID               string  `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Name             string  `json:"name" example:"My bottle"`
+	Amount           float64 `json:"amount" example:"750"`
+	Unit             string  `json:"unit" example:"ml"`
+	Type             string  `json:"type" example:"water"`
+	CustomBeverageID *string `json:"custom_beverage_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Icon             string  `json:"icon" example:"bottle"`
+	Position         int     `json:"position" example:"0"`
+
+	amountML int
+}
+
+// CreatePresetRequest takes either a catalog type or a custom drink. The
+// amount of a custom drink defaults to its serving.
+type CreatePresetRequest struct {
+	Name   string  `json:"name" binding:"required,max=50" example:"My bottle"`
+	Amount float64 `json:"amount" binding:"omitempty,gt=0" example:"750"`
+	// Unit of amount and of the response, defaults to the unit in the user's profile
+	Unit             string  `json:"unit" example:"ml"`
+	Type             string  `json:"type" example:"water"`
+	CustomBeverageID *string `json:"custom_beverage_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Icon             string  `json:"icon" example:"bottle"`
+}
+
+type UpdatePresetRequest struct {
+	Name             *string  `json:"name" binding:"omitempty,min=1,max=50" example:"My bottle"`
+	Amount           *float64 `json:"amount" binding:"omitempty,gt=0" example:"750"`
+	Unit             string   `json:"unit" example:"ml"`
+	Type             *string  `json:"type" example:"water"`
+	CustomBeverageID *string  `json:"custom_beverage_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Icon             *string  `json:"icon" example:"bottle"`
+}
+
+type ReorderPresetsRequest struct {
+	IDs []string `json:"ids" binding:"required" example:"550e8400-e29b-41d4-a716-446655440000"`
+}
+
+type LogPresetRequest struct {
+	// Timestamp backdates the entry (RFC 3339); defaults to now
+	Timestamp *time.Time `json:"timestamp" example:"2024-01-15T10:30:00Z"`
+}
+
+const presetColumns = "id, name, amount, type, custom_beverage_id, icon, position"
+
+// maxPresetML is the largest container a preset can hold
+const maxPresetML = 5000
+
+// createPresetsTable stores the quick-add buttons of each user, so they are
+// the same on every device.
+func createPresetsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS presets (
+		id UUID PRIMARY KEY,
+		user_id UUID NOT NULL,
+		name VARCHAR(50) NOT NULL,
+		amount INTEGER NOT NULL CHECK (amount > 0),
+		type VARCHAR(50) NOT NULL,
+		custom_beverage_id UUID REFERENCES custom_beverages(id) ON DELETE CASCADE,
+		icon VARCHAR(32) NOT NULL DEFAULT '` + internal.DefaultPresetIcon + `',
+		position INTEGER NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_presets_user_position ON presets(user_id, position);`)
+	return err
+}
+
+func scanPreset(row rowScanner) (Preset, error) {
+	var p Preset
+	err := row.Scan(&p.ID, &p.Name, &p.amountML, &p.Type, &p.CustomBeverageID, &p.Icon, &p.Position)
+	return p, err
+}
+
+// presetAmount converts the amount of a preset request to milliliters,
+// answering 400 for containers that are too large.
+func presetAmount(c *gin.Context, unit units.Unit, amount float64) (int, bool) {
+	ml, ok := toML(c, unit, amount, "amount")
+	if ok && ml > maxPresetML {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("amount must not exceed %d ml", maxPresetML)})
+		return 0, false
+	}
+	return ml, ok
+}
+
+// presetID returns the :id path parameter, answering 404 when it isn't a UUID.
+func presetID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Preset not found"})
+		return "", false
+	}
+	return id, true
+}
+
+// respondWithPreset writes the preset in unit or the error of the query that loaded it.
+func respondWithPreset(c *gin.Context, status int, p Preset, unit units.Unit, err error, failure string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Preset not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: failure})
+		return
+	}
+	p.setUnit(unit)
+	c.JSON(status, p)
+}
+
+// checkPresetDrink validates the drink of a preset the way a new entry would
+// be validated. It writes the error response and returns the custom drink, if any.
+func checkPresetDrink(c *gin.Context, userID string, entryType string, customID *string) (*CustomBeverage, bool) {
+	if customID != nil {
+		custom, err := loadCustomBeverage(db, userID, *customID, false)
+		if customBeverageError(c, err) {
+			return nil, false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save preset"})
+			return nil, false
+		}
+		return &custom, true
+	}
+	if _, ok := internal.LookupBeverage(entryType); !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: unknownBeverageError})
+		return nil, false
+	}
+	return nil, true
+}
+
+func checkPresetIcon(c *gin.Context, icon string) bool {
+	if !internal.ValidPresetIcon(icon) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Unknown icon"})
+		return false
+	}
+	return true
+}
+
+// GetPresets godoc
+// @Summary      Get quick-add presets / Получить пресеты
+// @Description  Quick-add presets of the user in display order / Пресеты быстрого добавления в порядке показа
+// @Tags         presets
+// @Produce      json
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {array}   Preset
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/presets [get]
+func getPresets(c *gin.Context) {
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	rows, err := db.Query("SELECT "+presetColumns+" FROM presets WHERE user_id = $1 ORDER BY position, created_at", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch presets"})
+		return
+	}
+	defer rows.Close()
+
+	presets := make([]Preset, 0)
+	for rows.Next() {
+		p, err := scanPreset(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch presets"})
+			return
+		}
+		p.setUnit(unit)
+		presets = append(presets, p)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch presets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, presets)
+}
+
+// CreatePreset godoc
+// @Summary      Create preset / Создать пресет
+// @Description  Add a quick-add preset at the end of the list / Добавить пресет в конец списка
+// @Tags         presets
+// @Accept       json
+// @Produce      json
+// @Param        data  body  CreatePresetRequest  true  "Preset / Пресет"
+// @Success      201   {object}  Preset
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/presets [post]
+func createPreset(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req CreatePresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if (req.Type == "") == (req.CustomBeverageID == nil) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Provide either type or custom_beverage_id"})
+		return
+	}
+	if req.Amount == 0 && req.CustomBeverageID == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "amount is required"})
+		return
+	}
+	if req.Icon == "" {
+		req.Icon = internal.DefaultPresetIcon
+	}
+	if !checkPresetIcon(c, req.Icon) {
+		return
+	}
+
+	custom, ok := checkPresetDrink(c, userID, req.Type, req.CustomBeverageID)
+	if !ok {
+		return
+	}
+	unit, ok := requestUnit(c, userID, req.Unit)
+	if !ok {
+		return
+	}
+	var amountML int
+	if req.Amount != 0 {
+		if amountML, ok = presetAmount(c, unit, req.Amount); !ok {
+			return
+		}
+	}
+	if custom != nil {
+		req.Type = internal.CustomBeverageType
+		if amountML == 0 {
+			amountML = custom.servingML
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save preset"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Creates of one user wait for each other, so concurrent ones can't both
+	// pass the limit or take the same position. The user row is locked because
+	// a user without presets has no preset rows to lock; NO KEY UPDATE doesn't
+	// hold up inserts that only reference the user.
+	var count int
+	err = tx.QueryRow("SELECT 1 FROM users WHERE id = $1 FOR NO KEY UPDATE", userID).Scan(new(int))
+	if err == nil {
+		err = tx.QueryRow("SELECT COUNT(*) FROM presets WHERE user_id = $1", userID).Scan(&count)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save preset"})
+		return
+	}
+	if count >= internal.MaxPresets {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("You can have at most %d presets", internal.MaxPresets)})
+		return
+	}
+
+	p, err := scanPreset(tx.QueryRow(`INSERT INTO presets (id, user_id, name, amount, type, custom_beverage_id, icon, position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, (SELECT COALESCE(MAX(position) + 1, 0) FROM presets WHERE user_id = $2))
+		RETURNING `+presetColumns,
+		uuid.New().String(), userID, req.Name, amountML, req.Type, req.CustomBeverageID, req.Icon))
+	if err == nil {
+		err = tx.Commit()
+	}
+	respondWithPreset(c, http.StatusCreated, p, unit, err, "Failed to save preset")
+}
+
+// UpdatePreset godoc
+// @Summary      Update preset / Изменить пресет
+// @Description  Change the name, amount, drink and/or icon of a preset / Изменить название, объём, напиток и/или иконку пресета
+// @Tags         presets
+// @Accept       json
+// @Produce      json
+// @Param        id    path  string               true  "Preset ID / ID пресета"
+// @Param        data  body  UpdatePresetRequest  true  "Changes / Изменения"
+// @Success      200   {object}  Preset
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Preset not found"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/presets/{id} [patch]
+func updatePreset(c *gin.Context) {
+	id, ok := presetID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetString("user_id")
+
+	var req UpdatePresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req == (UpdatePresetRequest{}) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Nothing to update"})
+		return
+	}
+	if req.Type != nil && req.CustomBeverageID != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Provide either type or custom_beverage_id"})
+		return
+	}
+	if req.Icon != nil && !checkPresetIcon(c, *req.Icon) {
+		return
+	}
+	if req.Type != nil || req.CustomBeverageID != nil {
+		entryType := ""
+		if req.Type != nil {
+			entryType = *req.Type
+		}
+		if _, ok := checkPresetDrink(c, userID, entryType, req.CustomBeverageID); !ok {
+			return
+		}
+	}
+	if req.CustomBeverageID != nil {
+		customType := internal.CustomBeverageType
+		req.Type = &customType
+	}
+	unit, ok := requestUnit(c, userID, req.Unit)
+	if !ok {
+		return
+	}
+	var amountML *int
+	if req.Amount != nil {
+		ml, ok := presetAmount(c, unit, *req.Amount)
+		if !ok {
+			return
+		}
+		amountML = &ml
+	}
+
+	// A catalog type replaces the custom drink; a custom drink sets type to "custom"
+	p, err := scanPreset(db.QueryRow(`UPDATE presets SET
+			name = COALESCE($3, name),
+			amount = COALESCE($4, amount),
+			type = COALESCE($5, type),
+			custom_beverage_id = CASE WHEN $6::uuid IS NOT NULL THEN $6
+				WHEN $5::text IS NOT NULL THEN NULL ELSE custom_beverage_id END,
+			icon = COALESCE($7, icon),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2
+		RETURNING `+presetColumns,
+		id, userID, req.Name, amountML, req.Type, req.CustomBeverageID, req.Icon))
+	respondWithPreset(c, http.StatusOK, p, unit, err, "Failed to save preset")
+}
+
+// DeletePreset godoc
+// @Summary      Delete preset / Удалить пресет
+// @Description  Delete a quick-add preset. Entries logged with it are kept / Удалить пресет, записи сохраняются
+// @Tags         presets
+// @Produce      json
+// @Param        id    path   string  true   "Preset ID / ID пресета"
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {object}  Preset  "Deleted preset"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Preset not found"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/presets/{id} [delete]
+func deletePreset(c *gin.Context) {
+	id, ok := presetID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetString("user_id")
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	p, err := scanPreset(db.QueryRow("DELETE FROM presets WHERE id = $1 AND user_id = $2 RETURNING "+presetColumns,
+		id, userID))
+	respondWithPreset(c, http.StatusOK, p, unit, err, "Failed to delete preset")
+}
+
+// ReorderPresets godoc
+// @Summary      Reorder presets / Изменить порядок пресетов
+// @Description  Set the display order. ids must list every preset of the user exactly once / Задать порядок показа, ids должны перечислять все пресеты ровно по разу
+// @Tags         presets
+// @Accept       json
+// @Produce      json
+// @Param        data  body  ReorderPresetsRequest  true  "Preset IDs in the new order / ID пресетов в новом порядке"
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {array}   Preset
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/presets/order [put]
+func reorderPresets(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req ReorderPresetsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reorder presets"})
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM presets WHERE user_id = $1 FOR UPDATE", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reorder presets"})
+		return
+	}
+	var existing []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reorder presets"})
+			return
+		}
+		existing = append(existing, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reorder presets"})
+		return
+	}
+
+	if err := internal.CheckPresetOrder(existing, req.IDs); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	for position, id := range req.IDs {
+		if _, err := tx.Exec("UPDATE presets SET position = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2",
+			id, userID, position); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reorder presets"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reorder presets"})
+		return
+	}
+
+	getPresets(c)
+}
+
+// LogPreset godoc
+// @Summary      Log preset / Добавить запись по пресету
+// @Description  Create an entry with the amount and drink of the preset, optionally backdated with timestamp / Создать запись с объёмом и напитком пресета
+// @Tags         presets
+// @Accept       json
+// @Produce      json
+// @Param        id    path  string            true   "Preset ID / ID пресета"
+// @Param        data  body  LogPresetRequest  false  "Entry time / Время записи"
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      201   {object}  HydrationEntry  "Entry created successfully"
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Preset not found"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/presets/{id}/log [post]
+func logPreset(c *gin.Context) {
+	id, ok := presetID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetString("user_id")
+
+	// The body is optional: a plain tap logs the preset now
+	var req LogPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	p, err := scanPreset(db.QueryRow("SELECT "+presetColumns+" FROM presets WHERE id = $1 AND user_id = $2", id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Preset not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create entry"})
+		return
+	}
+
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	// The preset is logged in milliliters so its amount is taken as is
+	create := CreateEntryRequest{
+		Amount:           float64(p.amountML),
+		Unit:             string(units.Milliliter),
+		Type:             p.Type,
+		CustomBeverageID: p.CustomBeverageID,
+		Timestamp:        req.Timestamp,
+	}
+	if p.CustomBeverageID != nil {
+		create.Type = ""
+	}
+	entry, ok := logEntry(c, userID, create)
+	if !ok {
+		return
+	}
+	entry.setUnit(unit)
+	c.JSON(http.StatusCreated, entry)
+}
+
+// setUnit fills the shown amount from the stored milliliters.
+func (p *Preset) setUnit(u units.Unit) {
+	p.Amount = u.FromML(p.amountML)
+	p.Unit = string(u)
+}
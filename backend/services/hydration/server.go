@@ -6,13 +6,20 @@ package hydration
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"hydration-tracking/internal/jwks"
+	"hydration-tracking/internal/revocation"
+	"hydration-tracking/internal/tz"
 	"hydration-tracking/services/hydration/docs"
+	"hydration-tracking/services/hydration/internal"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -22,29 +29,89 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
+// HydrationEntry is a logged drink. Amounts are stored in milliliters and
+// shown in Unit. EffectiveAmount is the part of Amount that counts toward
+// the goal, depending on the beverage type.
 type HydrationEntry struct {
-	ID        string    `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
-	UserID    string    `json:"user_id" example:"550e8400-e29b-41d4-a716-446655440000"`
-	Amount    int       `json:"amount" example:"250"`
-	Timestamp time.Time `json:"timestamp" example:"2024-01-15T10:30:00Z"`
-	Type      string    `json:"type" example:"water"`
+	ID              string    `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	UserID          string    `json:"user_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Amount          float64   `json:"amount" example:"250"`
+	EffectiveAmount float64   `json:"effective_amount" example:"200"`
+	Unit            string    `json:"unit" example:"ml"`
+	Timestamp       time.Time `json:"timestamp" example:"2024-01-15T10:30:00Z"`
+	Type            string    `json:"type" example:"coffee"`
+	// CustomBeverageID is set for drinks the user defined; Type is then "custom"
+	CustomBeverageID *string `json:"custom_beverage_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	// UnlockedAchievements lists the badges this entry earned; only set when logging
+	UnlockedAchievements []string `json:"unlocked_achievements,omitempty" example:"first_entry"`
+
+	amountML    int
+	effectiveML int
 }
 
+// CreateEntryRequest logs either a catalog beverage (type) or a custom drink
+// (custom_beverage_id). The amount of a custom drink defaults to its serving.
 type CreateEntryRequest struct {
-	Amount int    `json:"amount" binding:"required,min=1" example:"250"`
-	Type   string `json:"type" binding:"required" example:"water"`
+	Amount float64 `json:"amount" binding:"omitempty,gt=0" example:"250"`
+	// Unit of amount, defaults to the unit in the user's profile
+	Unit string `json:"unit" example:"ml"`
+	// Type is a beverage id from GET /api/v1/beverages
+	Type             string  `json:"type" example:"water"`
+	CustomBeverageID *string `json:"custom_beverage_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	// Timestamp backdates the entry (RFC 3339); defaults to now
+	Timestamp *time.Time `json:"timestamp" example:"2024-01-15T10:30:00Z"`
 }
 
+type EntryListResponse struct {
+	Entries    []HydrationEntry `json:"entries"`
+	NextCursor string           `json:"next_cursor,omitempty" example:"MjAyNC0wMS0xNVQxMDozMDowMFp8NTUwZTg0MDA"`
+	HasMore    bool             `json:"has_more" example:"true"`
+}
+
+const (
+	defaultEntryLimit = 50
+	maxEntryLimit     = 200
+)
+
+// UpdateGoalRequest sets a fixed goal, or switches to the auto mode where the
+// goal is recommended from the body profile.
 type UpdateGoalRequest struct {
-	Goal int `json:"goal" binding:"required,min=1" example:"2000"`
+	Goal float64 `json:"goal" binding:"omitempty,gt=0" example:"2000"`
+	// Unit of goal, defaults to the unit in the user's profile
+	Unit string `json:"unit" example:"ml"`
+	// Mode is fixed (default, goal required) or auto (no goal)
+	Mode string `json:"mode" binding:"omitempty,oneof=fixed auto" example:"fixed"`
+}
+
+// DrinkTotal is what was drunk of one beverage today.
+type DrinkTotal struct {
+	Type             string  `json:"type" example:"custom"`
+	CustomBeverageID *string `json:"custom_beverage_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Name             string  `json:"name" example:"Oat latte"`
+	Color            string  `json:"color,omitempty" example:"#C8A27A"`
+	Count            int     `json:"count" example:"2"`
+	Amount           float64 `json:"amount" example:"600"`
+	EffectiveAmount  float64 `json:"effective_amount" example:"510"`
 }
 
+// HydrationStats reports the volume drunk (total_*) and the hydration it
+// counts for (effective_*), in Unit. The goal percentage is based on the latter.
 type HydrationStats struct {
-	TotalToday     int `json:"total_today" example:"1500"`
-	TotalWeek      int `json:"total_week" example:"10500"`
-	TotalMonth     int `json:"total_month" example:"45000"`
-	Goal           int `json:"goal" example:"2000"`
-	GoalPercentage int `json:"goal_percentage" example:"75"`
+	TotalToday     float64 `json:"total_today" example:"1500"`
+	TotalWeek      float64 `json:"total_week" example:"10500"`
+	TotalMonth     float64 `json:"total_month" example:"45000"`
+	EffectiveToday float64 `json:"effective_today" example:"1400"`
+	EffectiveWeek  float64 `json:"effective_week" example:"9800"`
+	EffectiveMonth float64 `json:"effective_month" example:"42000"`
+	// Goal is today's goal: BaseGoal plus GoalAdjustments
+	Goal            float64          `json:"goal" example:"2500"`
+	BaseGoal        float64          `json:"base_goal" example:"2000"`
+	GoalAdjustments []GoalAdjustment `json:"goal_adjustments"`
+	GoalPercentage  int              `json:"goal_percentage" example:"56"`
+	Unit            string           `json:"unit" example:"ml"`
+	Timezone        string           `json:"timezone" example:"Asia/Vladivostok"`
+	// DrinksToday breaks today's intake down per drink, largest first
+	DrinksToday []DrinkTotal `json:"drinks_today"`
 }
 
 type ErrorResponse struct {
@@ -52,19 +119,26 @@ type ErrorResponse struct {
 }
 
 type UpdateGoalResponse struct {
-	Message string `json:"message" example:"Goal updated successfully"`
-	Goal    int    `json:"goal" example:"2000"`
+	Message string  `json:"message" example:"Goal updated successfully"`
+	Goal    float64 `json:"goal" example:"2000"`
+	Unit    string  `json:"unit" example:"ml"`
+	Mode    string  `json:"mode" example:"fixed"`
 }
 
 type Claims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	UserID     string `json:"user_id"`
+	Username   string `json:"username"`
+	Unverified bool   `json:"unverified,omitempty"`
+	Purpose    string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
 var (
-	db     *sql.DB
-	secret []byte
+	db         *sql.DB
+	verifyKeys *jwks.Cache
+	revoked    revocation.Store = revocation.NewMemoryStore()
+	// entryMaxBackdate limits how far in the past an entry may be logged
+	entryMaxBackdate = 7 * 24 * time.Hour
 )
 
 func getEnv(key, defaultValue string) string {
@@ -74,12 +148,31 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func initSecret() {
-	envSecret := os.Getenv("JWT_SECRET")
-	if envSecret == "" {
-		log.Fatal("JWT_SECRET env variable not set")
+// initVerifyKeys points token verification at the auth service's JWKS.
+// This service only holds public keys and cannot mint tokens itself.
+func initVerifyKeys() {
+	url := getEnv("AUTH_JWKS_URL", "http://localhost:8081/.well-known/jwks.json")
+	ttl, err := time.ParseDuration(getEnv("JWKS_CACHE_TTL", "5m"))
+	if err != nil {
+		log.Fatalf("Invalid JWKS_CACHE_TTL: %v", err)
+	}
+	verifyKeys = jwks.NewCache(url, ttl)
+}
+
+func initEntryLimits() {
+	maxBackdate, err := time.ParseDuration(getEnv("ENTRY_MAX_BACKDATE", entryMaxBackdate.String()))
+	if err != nil {
+		log.Fatalf("Invalid ENTRY_MAX_BACKDATE: %v", err)
 	}
-	secret = []byte(envSecret)
+	entryMaxBackdate = maxBackdate
+}
+
+func initRevocation() {
+	store, err := revocation.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	revoked = store
 }
 
 func InitDB() {
@@ -105,10 +198,14 @@ func InitDB() {
 		id UUID PRIMARY KEY,
 		user_id UUID NOT NULL,
 		amount INTEGER NOT NULL,
-		timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
 		type VARCHAR(50) NOT NULL,
-		FOREIGN KEY (user_id) REFERENCES users(id)
-	);`
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	ALTER TABLE hydration_entries ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP;
+	CREATE INDEX IF NOT EXISTS idx_hydration_entries_user_created ON hydration_entries(user_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_hydration_entries_user_timestamp ON hydration_entries(user_id, timestamp, id);`
 
 	_, err = db.Exec(createTable)
 	if err != nil {
@@ -122,18 +219,99 @@ func InitDB() {
 		daily_goal INTEGER DEFAULT 2000,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id)
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	);`
 
 	_, err = db.Exec(createGoalsTable)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	// Tables created before account deletion existed lack ON DELETE CASCADE.
+	// The key is only replaced when it doesn't cascade yet, since adding it
+	// validates every row.
+	cascadeUserForeignKeys := `
+	DO $$
+	DECLARE
+		tbl TEXT;
+	BEGIN
+		FOREACH tbl IN ARRAY ARRAY['hydration_entries', 'user_goals'] LOOP
+			IF NOT EXISTS (
+				SELECT 1 FROM pg_constraint
+				WHERE conname = tbl || '_user_id_fkey' AND conrelid = tbl::regclass
+					AND confdeltype = 'c'
+			) THEN
+				EXECUTE format('ALTER TABLE %I DROP CONSTRAINT IF EXISTS %I, ADD CONSTRAINT %I FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE',
+					tbl, tbl || '_user_id_fkey', tbl || '_user_id_fkey');
+			END IF;
+		END LOOP;
+	END $$;`
+
+	_, err = db.Exec(cascadeUserForeignKeys)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createGoalHistoryTable(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createEffectiveAmountColumn(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createCustomBeveragesTable(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createPresetsTable(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createAchievementsTable(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createBodyProfilesTable(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createWeatherTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createExerciseSessionsTable(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Older tables stored TIMESTAMP columns filled by CURRENT_TIMESTAMP, i.e.
+	// wall-clock time in the database's TimeZone, which is what the values are
+	// interpreted in here (the server default, as the service doesn't set one)
+	convertToTimestamptz := `
+	DO $$
+	DECLARE
+		col TEXT;
+	BEGIN
+		FOREACH col IN ARRAY ARRAY['timestamp', 'created_at'] LOOP
+			IF EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_name = 'hydration_entries' AND column_name = col
+					AND data_type = 'timestamp without time zone'
+			) THEN
+				EXECUTE format('ALTER TABLE hydration_entries ALTER COLUMN %I TYPE TIMESTAMPTZ USING %I AT TIME ZONE current_setting(''TimeZone'')', col, col);
+			END IF;
+		END LOOP;
+	END $$;`
+
+	_, err = db.Exec(convertToTimestamptz)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
 // CreateEntry godoc
 // @Summary      Add hydration entry / Добавить запись о приёме воды
-// @Description  Add a new hydration entry for the user / Добавить новую запись о приёме воды
+// @Description  Add a new hydration entry for a catalog beverage or a custom drink, optionally backdated with timestamp / Добавить новую запись о напитке из каталога или своём напитке, можно указать прошедшее время
 // @Tags         hydration
 // @Accept       json
 // @Produce      json
@@ -156,32 +334,108 @@ func createEntry(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if entry, ok := logEntry(c, userID, req); ok {
+		c.JSON(http.StatusCreated, entry)
+	}
+}
+
+// logEntry validates and stores a new entry, which is returned in the unit of
+// the request. Entries created from presets go through here as well. It
+// writes the error response on failure.
+func logEntry(c *gin.Context, userID string, req CreateEntryRequest) (HydrationEntry, bool) {
+	if (req.Type == "") == (req.CustomBeverageID == nil) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Provide either type or custom_beverage_id"})
+		return HydrationEntry{}, false
+	}
+	if req.CustomBeverageID == nil {
+		if req.Amount == 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "amount is required"})
+			return HydrationEntry{}, false
+		}
+		if _, ok := internal.LookupBeverage(req.Type); !ok {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: unknownBeverageError})
+			return HydrationEntry{}, false
+		}
+	}
+
+	timestamp, err := internal.ResolveEntryTime(req.Timestamp, time.Now(), entryMaxBackdate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: entryTimeError(err)})
+		return HydrationEntry{}, false
+	}
+
+	unit, ok := requestUnit(c, userID, req.Unit)
+	if !ok {
+		return HydrationEntry{}, false
+	}
 
 	entryID := uuid.New().String()
 	entry := HydrationEntry{
 		ID:        entryID,
 		UserID:    userID,
-		Amount:    req.Amount,
 		Type:      req.Type,
-		Timestamp: time.Now(),
+		Timestamp: timestamp,
+	}
+	if req.Amount != 0 {
+		if entry.amountML, ok = toML(c, unit, req.Amount, "amount"); !ok {
+			return HydrationEntry{}, false
+		}
+	}
+
+	if req.CustomBeverageID != nil {
+		custom, err := loadCustomBeverage(db, userID, *req.CustomBeverageID, false)
+		if customBeverageError(c, err) {
+			return HydrationEntry{}, false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create entry"})
+			return HydrationEntry{}, false
+		}
+		if entry.amountML == 0 {
+			entry.amountML = custom.servingML
+		}
+		entry.Type = internal.CustomBeverageType
+		entry.CustomBeverageID = &custom.ID
+		entry.effectiveML = custom.beverage().EffectiveAmount(entry.amountML)
+	} else {
+		entry.effectiveML = internal.EffectiveAmount(entry.amountML, entry.Type)
 	}
 
-	_, err := db.Exec("INSERT INTO hydration_entries (id, user_id, amount, type) VALUES ($1, $2, $3, $4)",
-		entry.ID, entry.UserID, entry.Amount, entry.Type)
+	_, err = db.Exec("INSERT INTO hydration_entries (id, user_id, amount, effective_amount, type, custom_beverage_id, timestamp) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		entry.ID, entry.UserID, entry.amountML, entry.effectiveML, entry.Type, entry.CustomBeverageID, entry.Timestamp)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create entry"})
-		return
+		return HydrationEntry{}, false
 	}
 
-	c.JSON(http.StatusCreated, entry)
+	// The day's goal is settled before badges judge it: the weather of today
+	// is recorded with its first entry
+	if weatherProvider != nil {
+		loc := userLocation(userID)
+		if today := internal.DateKey(time.Now().In(loc)); internal.DateKey(entry.Timestamp.In(loc)) == today {
+			recordWeatherAdjustment(c.Request.Context(), userID, today)
+		}
+	}
+	entry.UnlockedAchievements = unlockAchievementsAfterEntry(userID, entry)
+	entry.setUnit(unit)
+	return entry, true
 }
 
 // GetEntries godoc
-// @Summary      Get all hydration entries / Получить все записи
-// @Description  Get all hydration entries for the user / Получить все записи пользователя
+// @Summary      Get hydration entries / Получить записи
+// @Description  Get a page of the user's entries. Pass next_cursor back as cursor to get the next page / Получить страницу записей пользователя
 // @Tags         hydration
 // @Produce      json
-// @Success      200   {array}  HydrationEntry  "List of hydration entries"
+// @Param        limit   query  int     false  "Page size, 1-200 (default 50) / Размер страницы"
+// @Param        cursor  query  string  false  "next_cursor of the previous page / Курсор следующей страницы"
+// @Param        from    query  string  false  "Start, RFC 3339 time or YYYY-MM-DD in the user's timezone / Начало периода"
+// @Param        to      query  string  false  "End (inclusive), RFC 3339 time or YYYY-MM-DD / Конец периода"
+// @Param        type    query  string  false  "Drink type / Тип напитка"
+// @Param        custom_beverage_id  query  string  false  "Custom drink / Свой напиток"
+// @Param        order   query  string  false  "desc (newest first, default) or asc / Порядок сортировки"
+// @Param        unit    query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
+// @Success      200   {object}  EntryListResponse  "Page of hydration entries"
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid query"
 // @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
 // @Failure      500   {object}  ErrorResponse  "Internal Server Error"
 // @Security     BearerAuth
@@ -193,31 +447,129 @@ func getEntries(c *gin.Context) {
 		return
 	}
 
-	rows, err := db.Query("SELECT id, user_id, amount, timestamp, type FROM hydration_entries WHERE user_id = $1 ORDER BY timestamp DESC", userID)
+	limit := defaultEntryLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxEntryLimit {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("limit must be between 1 and %d", maxEntryLimit)})
+			return
+		}
+		limit = n
+	}
+
+	order := c.DefaultQuery("order", "desc")
+	if order != "desc" && order != "asc" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "order must be asc or desc"})
+		return
+	}
+
+	conditions := []string{"user_id = $1"}
+	args := []interface{}{userID}
+	addCondition := func(format string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(format, placeholders...))
+	}
+
+	// Dates without a time are days in the user's timezone
+	from, to := c.Query("from"), c.Query("to")
+	if from != "" || to != "" {
+		loc := userLocation(userID)
+		if from != "" {
+			start, err := internal.ParseRangeStart(from, loc)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from must be an RFC 3339 time or YYYY-MM-DD"})
+				return
+			}
+			addCondition("timestamp >= $%d", start)
+		}
+		if to != "" {
+			end, err := internal.ParseRangeEnd(to, loc)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "to must be an RFC 3339 time or YYYY-MM-DD"})
+				return
+			}
+			addCondition("timestamp < $%d", end)
+		}
+	}
+
+	if entryType := c.Query("type"); entryType != "" {
+		addCondition("type = $%d", entryType)
+	}
+	if customID := c.Query("custom_beverage_id"); customID != "" {
+		if _, err := uuid.Parse(customID); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "custom_beverage_id must be a UUID"})
+			return
+		}
+		addCondition("custom_beverage_id = $%d", customID)
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		timestamp, id, err := internal.DecodeCursor(cursor)
+		if err == nil {
+			_, err = uuid.Parse(id)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid cursor"})
+			return
+		}
+		if order == "desc" {
+			addCondition("(timestamp, id) < ($%d, $%d)", timestamp, id)
+		} else {
+			addCondition("(timestamp, id) > ($%d, $%d)", timestamp, id)
+		}
+	}
+
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
+	}
+
+	// One extra row tells whether another page exists
+	query := fmt.Sprintf("SELECT %s FROM hydration_entries WHERE %s ORDER BY timestamp %s, id %s LIMIT %d",
+		entryColumns, strings.Join(conditions, " AND "), order, order, limit+1)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch entries"})
 		return
 	}
 	defer rows.Close()
 
-	var entries []HydrationEntry
+	entries := make([]HydrationEntry, 0, limit)
 	for rows.Next() {
-		var entry HydrationEntry
-		err := rows.Scan(&entry.ID, &entry.UserID, &entry.Amount, &entry.Timestamp, &entry.Type)
+		entry, err := scanEntry(rows)
 		if err != nil {
-			continue
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch entries"})
+			return
 		}
+		entry.setUnit(unit)
 		entries = append(entries, entry)
 	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch entries"})
+		return
+	}
+
+	response := EntryListResponse{Entries: entries}
+	if len(entries) > limit {
+		response.Entries = entries[:limit]
+		response.HasMore = true
+		last := response.Entries[limit-1]
+		response.NextCursor = internal.EncodeCursor(last.Timestamp, last.ID)
+	}
 
-	c.JSON(http.StatusOK, entries)
+	c.JSON(http.StatusOK, response)
 }
 
 // GetStats godoc
 // @Summary      Get hydration stats / Получить статистику
-// @Description  Get hydration statistics for the user / Получить статистику пользователя
+// @Description  Get hydration statistics for the user: volume drunk and effective hydration, which the goal percentage is based on. The goal includes the adjustments recorded for today, such as extra water on a hot day or after a workout / Получить статистику пользователя: выпитый объём и эффективную гидратацию
 // @Tags         hydration
 // @Produce      json
+// @Param        unit  query  string  false  "Unit of the amounts, defaults to the profile's / Единица объёма"
 // @Success      200   {object}  HydrationStats  "Hydration statistics"
 // @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
 // @Failure      500   {object}  ErrorResponse  "Internal Server Error"
@@ -230,64 +582,114 @@ func getStats(c *gin.Context) {
 		return
 	}
 
-	// Get daily goal
-	var goal int
-	err := db.QueryRow("SELECT daily_goal FROM user_goals WHERE user_id = $1", userID).Scan(&goal)
-	if err != nil {
-		// Set default goal if not found
-		goal = 2000
-		_, err = db.Exec("INSERT INTO user_goals (user_id, daily_goal) VALUES ($1, $2)", userID, goal)
-		if err != nil {
-			log.Printf("Failed to create user goal: %v", err)
-		}
+	unit, ok := requestUnit(c, userID, "")
+	if !ok {
+		return
 	}
+	baseGoal := loadDailyGoal(userID)
 
-	// Get today's total
-	var totalToday int
-	today := time.Now().Format("2006-01-02")
-	err = db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM hydration_entries WHERE user_id = $1 AND DATE(timestamp) = $2",
-		userID, today).Scan(&totalToday)
-	if err != nil {
-		totalToday = 0
-	}
+	// Days start at midnight in the user's timezone
+	loc := userLocation(userID)
+	w := internal.WindowsAt(time.Now().In(loc))
 
-	// Get week's total
-	var totalWeek int
-	weekAgo := time.Now().AddDate(0, 0, -7).Format("2006-01-02")
-	err = db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM hydration_entries WHERE user_id = $1 AND DATE(timestamp) >= $2",
-		userID, weekAgo).Scan(&totalWeek)
+	adjustments, err := loadDayAdjustments(userID, w.DayStart)
 	if err != nil {
-		totalWeek = 0
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch stats"})
+		return
+	}
+	// Normally the first entry of the day has recorded the weather already;
+	// before that it is looked up in the background rather than holding up stats
+	if !hasAdjustment(adjustments, adjustmentSourceWeather) {
+		recordWeatherAdjustmentInBackground(userID, internal.DateKey(w.DayStart))
+	}
+	goal := baseGoal
+	for i := range adjustments {
+		goal += adjustments[i].amountML
+		adjustments[i].Amount = unit.FromML(adjustments[i].amountML)
 	}
 
-	// Get month's total
-	var totalMonth int
-	monthAgo := time.Now().AddDate(0, -1, 0).Format("2006-01-02")
-	err = db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM hydration_entries WHERE user_id = $1 AND DATE(timestamp) >= $2",
-		userID, monthAgo).Scan(&totalMonth)
+	// Sums in milliliters, converted for the response
+	var totals internal.HydrationStats
+	err = db.QueryRow(`SELECT
+			COALESCE(SUM(amount) FILTER (WHERE timestamp >= $2), 0),
+			COALESCE(SUM(amount) FILTER (WHERE timestamp >= $3), 0),
+			COALESCE(SUM(amount), 0),
+			COALESCE(SUM(effective_amount) FILTER (WHERE timestamp >= $2), 0),
+			COALESCE(SUM(effective_amount) FILTER (WHERE timestamp >= $3), 0),
+			COALESCE(SUM(effective_amount), 0)
+		FROM hydration_entries WHERE user_id = $1 AND timestamp >= $4 AND timestamp < $5`,
+		userID, w.DayStart, w.WeekStart, w.MonthStart, w.DayEnd).Scan(
+		&totals.TotalToday, &totals.TotalWeek, &totals.TotalMonth,
+		&totals.EffectiveToday, &totals.EffectiveWeek, &totals.EffectiveMonth)
 	if err != nil {
-		totalMonth = 0
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch stats"})
+		return
 	}
 
-	percent := 0
+	stats := HydrationStats{
+		TotalToday:      unit.FromML(totals.TotalToday),
+		TotalWeek:       unit.FromML(totals.TotalWeek),
+		TotalMonth:      unit.FromML(totals.TotalMonth),
+		EffectiveToday:  unit.FromML(totals.EffectiveToday),
+		EffectiveWeek:   unit.FromML(totals.EffectiveWeek),
+		EffectiveMonth:  unit.FromML(totals.EffectiveMonth),
+		Goal:            unit.FromML(goal),
+		BaseGoal:        unit.FromML(baseGoal),
+		GoalAdjustments: adjustments,
+		Unit:            string(unit),
+		Timezone:        loc.String(),
+	}
 	if goal > 0 {
-		percent = totalToday * 100 / goal
+		stats.GoalPercentage = totals.EffectiveToday * 100 / goal
 	}
 
-	stats := HydrationStats{
-		TotalToday:     totalToday,
-		TotalWeek:      totalWeek,
-		TotalMonth:     totalMonth,
-		Goal:           goal,
-		GoalPercentage: percent,
+	stats.DrinksToday, err = loadDrinkTotals(userID, w.DayStart, w.DayEnd, unit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch stats"})
+		return
 	}
 
 	c.JSON(http.StatusOK, stats)
 }
 
+// loadDailyGoal returns the user's goal, creating the default one on first use.
+// In auto mode the goal is computed from the body profile.
+func loadDailyGoal(userID string) int {
+	var goal int
+	var mode string
+	err := db.QueryRow("SELECT daily_goal, goal_mode FROM user_goals WHERE user_id = $1", userID).Scan(&goal, &mode)
+	if err == nil && mode == goalModeAuto {
+		return autoGoal(userID, goal)
+	}
+	if err != nil {
+		// Set default goal if not found
+		goal = internal.DefaultDailyGoal
+		_, err = db.Exec("INSERT INTO user_goals (user_id, daily_goal) VALUES ($1, $2)", userID, goal)
+		if err != nil {
+			log.Printf("Failed to create user goal: %v", err)
+		}
+	}
+	return goal
+}
+
+// userLocation returns the timezone from the user's profile, which the auth
+// service owns. Unknown zones fall back to UTC.
+func userLocation(userID string) *time.Location {
+	var name string
+	if err := db.QueryRow("SELECT timezone FROM users WHERE id = $1", userID).Scan(&name); err != nil {
+		log.Printf("Failed to load timezone of user %s: %v", userID, err)
+		return time.UTC
+	}
+	loc, err := tz.Load(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 // UpdateGoal godoc
 // @Summary      Update daily goal / Обновить дневную цель
-// @Description  Update daily hydration goal for the user / Обновить дневную цель пользователя
+// @Description  Set a fixed daily goal, or switch to "mode": "auto" to use the goal recommended from the body profile (see GET /api/v1/goal/recommendation). Effective from today / Задать дневную цель или режим auto, начиная с сегодняшнего дня
 // @Tags         hydration
 // @Accept       json
 // @Produce      json
@@ -311,14 +713,46 @@ func updateGoal(c *gin.Context) {
 		return
 	}
 
-	_, err := db.Exec("INSERT INTO user_goals (user_id, daily_goal) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET daily_goal = $2, updated_at = CURRENT_TIMESTAMP",
-		userID, req.Goal)
-	if err != nil {
+	if req.Mode == "" {
+		req.Mode = goalModeFixed
+	}
+	if req.Mode == goalModeFixed && req.Goal == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "goal is required"})
+		return
+	}
+	if req.Mode == goalModeAuto && req.Goal != 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "goal is computed from the body profile in auto mode"})
+		return
+	}
+
+	unit, ok := requestUnit(c, userID, req.Unit)
+	if !ok {
+		return
+	}
+	var goal int
+	if req.Mode == goalModeAuto {
+		profile, err := loadBodyProfile(userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Set a body profile before using auto mode"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update goal"})
+			return
+		}
+		goal = internal.Recommend(profile.metrics()).Goal
+	} else if goal, ok = toML(c, unit, req.Goal, "goal"); !ok {
+		return
+	}
+
+	// The new goal applies from today in the user's timezone; earlier days keep theirs
+	today := time.Now().In(userLocation(userID))
+	if err := saveGoal(userID, goal, req.Mode, today); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update goal"})
 		return
 	}
 
-	c.JSON(http.StatusOK, UpdateGoalResponse{Message: "Goal updated successfully", Goal: req.Goal})
+	c.JSON(http.StatusOK, UpdateGoalResponse{Message: "Goal updated successfully", Goal: unit.FromML(goal), Unit: string(unit), Mode: req.Mode})
 }
 
 func authMiddleware() gin.HandlerFunc {
@@ -334,9 +768,7 @@ func authMiddleware() gin.HandlerFunc {
 			tokenString = tokenString[7:]
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return secret, nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, verifyKeys.Keyfunc)
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid token"})
@@ -345,14 +777,55 @@ func authMiddleware() gin.HandlerFunc {
 		}
 
 		claims := token.Claims.(*Claims)
+		// Special-use tokens such as MFA challenges are not access tokens
+		if claims.Purpose != "" {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		isRevoked, err := revoked.IsRevoked(c.Request.Context(), claims.ID, claims.UserID, issuedAt)
+		if err != nil {
+			log.Printf("Failed to check token revocation: %v", err)
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Session store unavailable"})
+			c.Abort()
+			return
+		}
+		if isRevoked {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("email_unverified", claims.Unverified)
+		c.Next()
+	}
+}
+
+// requireVerifiedEmail keeps accounts with an unverified email read-only.
+// The auth service only issues such tokens with EMAIL_VERIFICATION_POLICY=limit.
+func requireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("email_unverified") && c.Request.Method != http.MethodGet {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Email verification required"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
 func StartServer() error {
-	initSecret()
+	initVerifyKeys()
+	initRevocation()
+	initEntryLimits()
+	initWeather()
 	r := gin.Default()
 
 	// Swagger documentation
@@ -369,12 +842,42 @@ func StartServer() error {
 	})
 
 	api := r.Group("/api/v1")
-	api.Use(authMiddleware())
+	api.Use(authMiddleware(), requireVerifiedEmail())
 	{
 		api.POST("/entries", createEntry)
 		api.GET("/entries", getEntries)
+		api.POST("/entries/undo", undoLastEntry)
+		api.GET("/entries/:id", getEntry)
+		api.PATCH("/entries/:id", updateEntry)
+		api.DELETE("/entries/:id", deleteEntry)
+		api.GET("/beverages", getBeverages)
+		api.GET("/custom-beverages", getCustomBeverages)
+		api.POST("/custom-beverages", createCustomBeverage)
+		api.PATCH("/custom-beverages/:id", updateCustomBeverage)
+		api.DELETE("/custom-beverages/:id", archiveCustomBeverage)
+		api.GET("/presets", getPresets)
+		api.POST("/presets", createPreset)
+		api.PUT("/presets/order", reorderPresets)
+		api.PATCH("/presets/:id", updatePreset)
+		api.DELETE("/presets/:id", deletePreset)
+		api.POST("/presets/:id/log", logPreset)
 		api.GET("/stats", getStats)
+		api.GET("/history", getHistory)
+		api.GET("/streaks", getStreaks)
+		api.GET("/achievements", getAchievements)
 		api.PUT("/goal", updateGoal)
+		api.GET("/goal/history", getGoalHistory)
+		api.GET("/goal/recommendation", getGoalRecommendation)
+		api.GET("/body-profile", getBodyProfile)
+		api.PUT("/body-profile", updateBodyProfile)
+		api.GET("/location", getLocation)
+		api.PUT("/location", updateLocation)
+		api.DELETE("/location", deleteLocation)
+		api.GET("/exercise-sessions", getExerciseSessions)
+		api.POST("/exercise-sessions", createExerciseSession)
+		api.GET("/exercise-sessions/:id", getExerciseSession)
+		api.PATCH("/exercise-sessions/:id", updateExerciseSession)
+		api.DELETE("/exercise-sessions/:id", deleteExerciseSession)
 	}
 
 	log.Println("Hydration service starting on port 8082")
@@ -0,0 +1,112 @@
+package hydration
+
+import (
+	"net/http"
+	"time"
+
+	"hydration-tracking/services/hydration/internal"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreakResponse is the run of consecutive days on which the goal in effect
+// that day was met, in the user's timezone.
+type StreakResponse struct {
+	Current int `json:"current" example:"12"`
+	Longest int `json:"longest" example:"30"`
+	// StartDate is the first day of the current streak, empty without one
+	StartDate string `json:"start_date,omitempty" example:"2024-01-04"`
+	// TodayMet tells whether today already counts; an unmet today doesn't break the streak yet
+	TodayMet         bool `json:"today_met" example:"false"`
+	FreezesAvailable int  `json:"freezes_available" example:"1"`
+	MaxFreezes       int  `json:"max_freezes" example:"2"`
+	// DaysToNextFreeze is 0 while the maximum is held
+	DaysToNextFreeze int `json:"days_to_next_freeze" example:"3"`
+	// FrozenDays are the missed days of the current streak covered by a freeze
+	FrozenDays []string `json:"frozen_days"`
+	Timezone   string   `json:"timezone" example:"Asia/Vladivostok"`
+}
+
+// GetStreaks godoc
+// @Summary      Get goal streaks / Получить серии
+// @Description  Current and longest run of days with the daily goal met, in the user's timezone and with the goal in effect each day. Every 7 met days in a row earn a freeze (at most 2), which is spent automatically on a missed day so the streak survives. Replayed from all entries, so edited or backdated entries are always reflected / Текущая и самая длинная серия дней с выполненной целью и заморозки
+// @Tags         hydration
+// @Produce      json
+// @Success      200   {object}  StreakResponse
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/streaks [get]
+func getStreaks(c *gin.Context) {
+	userID := c.GetString("user_id")
+	loc := userLocation(userID)
+	streak, err := loadStreak(userID, loc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch streaks"})
+		return
+	}
+
+	response := StreakResponse{
+		Current:          streak.Current,
+		Longest:          streak.Longest,
+		TodayMet:         streak.TodayMet,
+		FreezesAvailable: streak.FreezesAvailable,
+		MaxFreezes:       internal.MaxFreezes,
+		DaysToNextFreeze: streak.DaysToNextFreeze,
+		FrozenDays:       make([]string, 0, len(streak.FrozenDays)),
+		Timezone:         loc.String(),
+	}
+	if streak.Current > 0 {
+		response.StartDate = internal.DateKey(streak.Start)
+	}
+	for _, day := range streak.FrozenDays {
+		response.FrozenDays = append(response.FrozenDays, internal.DateKey(day))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// loadStreak replays the streak of the user from the first entry up to today
+// in loc.
+func loadStreak(userID string, loc *time.Location) (internal.Streak, error) {
+	today := internal.BucketStart(time.Now().In(loc), internal.GranularityDay)
+
+	// Effective total per calendar day of the user's timezone since the first entry
+	rows, err := db.Query(`SELECT (timestamp AT TIME ZONE $2)::date, SUM(effective_amount)
+		FROM hydration_entries
+		WHERE user_id = $1 AND timestamp < $3
+		GROUP BY 1
+		ORDER BY 1`, userID, loc.String(), today.AddDate(0, 0, 1))
+	if err != nil {
+		return internal.Streak{}, err
+	}
+	defer rows.Close()
+
+	from := today
+	totals := make(map[string]int)
+	for rows.Next() {
+		var day time.Time
+		var total int
+		if err := rows.Scan(&day, &total); err != nil {
+			return internal.Streak{}, err
+		}
+		if len(totals) == 0 {
+			y, m, d := day.Date()
+			from = time.Date(y, m, d, 0, 0, 0, 0, loc)
+		}
+		totals[internal.DateKey(day)] = total
+	}
+	if err := rows.Err(); err != nil {
+		return internal.Streak{}, err
+	}
+
+	goals, err := loadGoalTimeline(userID)
+	if err != nil {
+		return internal.Streak{}, err
+	}
+	adjustments, err := loadGoalAdjustments(userID, from, today)
+	if err != nil {
+		return internal.Streak{}, err
+	}
+	return internal.ReplayStreak(totals, from, today, goals.WithAdjustments(adjustments)), nil
+}
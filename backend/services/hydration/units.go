@@ -0,0 +1,59 @@
+package hydration
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"hydration-tracking/internal/units"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userUnit returns the volume unit from the user's profile, which the auth
+// service owns. Unknown units fall back to milliliters.
+func userUnit(userID string) units.Unit {
+	var name string
+	if err := db.QueryRow("SELECT unit FROM users WHERE id = $1", userID).Scan(&name); err != nil {
+		log.Printf("Failed to load unit of user %s: %v", userID, err)
+		return units.Default
+	}
+	unit, err := units.Parse(name)
+	if err != nil {
+		return units.Default
+	}
+	return unit
+}
+
+// requestUnit resolves the unit amounts of a request are given and returned
+// in: explicit (the body's unit field), then the unit query parameter, then
+// the user's preference. It answers 400 for unknown units.
+func requestUnit(c *gin.Context, userID, explicit string) (units.Unit, bool) {
+	if explicit == "" {
+		explicit = c.Query("unit")
+	}
+	if explicit == "" {
+		return userUnit(userID), true
+	}
+	unit, err := units.Parse(explicit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return "", false
+	}
+	return unit, true
+}
+
+// toML converts an amount of the request to milliliters, answering 400 when
+// it can't be stored exactly.
+func toML(c *gin.Context, unit units.Unit, amount float64, field string) (int, bool) {
+	ml, err := unit.ToML(amount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("%s must have at most %d decimal places in %s", field, unit.Decimals(), unit)})
+		return 0, false
+	}
+	if ml < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("%s must be at least 1 ml", field)})
+		return 0, false
+	}
+	return ml, true
+}
@@ -0,0 +1,332 @@
+package hydration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"hydration-tracking/services/hydration/internal"
+	"hydration-tracking/services/hydration/internal/weather"
+
+	"github.com/gin-gonic/gin"
+)
+
+// weatherProvider is nil when WEATHER_PROVIDER=none; goals are then not adjusted.
+var weatherProvider weather.Provider
+
+func initWeather() {
+	p, err := weather.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	weatherProvider = p
+}
+
+// weatherRetryAfter is how long a user's day isn't looked up again after an
+// attempt, so a failing provider isn't asked, and waited for, on every request.
+const weatherRetryAfter = 5 * time.Minute
+
+var (
+	weatherAttemptsMu sync.Mutex
+	weatherAttempts   = make(map[string]time.Time)
+	weatherNextSweep  time.Time
+)
+
+// claimWeatherAttempt reports whether the weather of key (user and day) may be
+// looked up at now, and if so blocks further attempts for weatherRetryAfter.
+// This also keeps concurrent requests from asking the provider twice.
+func claimWeatherAttempt(key string, now time.Time) bool {
+	weatherAttemptsMu.Lock()
+	defer weatherAttemptsMu.Unlock()
+
+	if !now.Before(weatherNextSweep) {
+		weatherNextSweep = now.Add(time.Minute)
+		for k, retryAt := range weatherAttempts {
+			if !now.Before(retryAt) {
+				delete(weatherAttempts, k)
+			}
+		}
+	}
+	if retryAt, ok := weatherAttempts[key]; ok && now.Before(retryAt) {
+		return false
+	}
+	weatherAttempts[key] = now.Add(weatherRetryAfter)
+	return true
+}
+
+// Sources of goal adjustments: the extra water of a hot or humid day, and of
+// the workouts of the day.
+const (
+	adjustmentSourceWeather  = "weather"
+	adjustmentSourceExercise = "exercise"
+)
+
+type Location struct {
+	Latitude  float64   `json:"latitude" example:"43.1155"`
+	Longitude float64   `json:"longitude" example:"131.8855"`
+	UpdatedAt time.Time `json:"updated_at" example:"2024-01-15T10:30:00Z"`
+}
+
+type UpdateLocationRequest struct {
+	Latitude  *float64 `json:"latitude" binding:"required,min=-90,max=90" example:"43.1155"`
+	Longitude *float64 `json:"longitude" binding:"required,min=-180,max=180" example:"131.8855"`
+}
+
+// GoalAdjustment is extra water added to one day's goal.
+type GoalAdjustment struct {
+	// Source is weather or exercise
+	Source string  `json:"source" example:"weather"`
+	Amount float64 `json:"amount" example:"500"`
+	// MaxTempC and Humidity are the conditions a weather adjustment was based on
+	MaxTempC *float64 `json:"max_temp_c,omitempty" example:"30.5"`
+	Humidity *float64 `json:"humidity,omitempty" example:"64"`
+
+	amountML int
+}
+
+// createWeatherTables stores the user's location and the adjustments made to
+// each day's goal. An adjustment is recorded once per day, so the goal of a
+// past day doesn't change with later forecasts or a new location.
+func createWeatherTables() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS user_locations (
+		user_id UUID PRIMARY KEY,
+		latitude DOUBLE PRECISION NOT NULL,
+		longitude DOUBLE PRECISION NOT NULL,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS daily_goal_adjustments (
+		user_id UUID NOT NULL,
+		day DATE NOT NULL,
+		source VARCHAR(20) NOT NULL,
+		amount INTEGER NOT NULL CHECK (amount >= 0),
+		max_temp_c NUMERIC(4,1),
+		humidity NUMERIC(4,1),
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, day, source),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`)
+	return err
+}
+
+// recordWeatherAdjustment looks up the weather of day (YYYY-MM-DD) at the
+// user's location and records the extra water it calls for, even when that is
+// nothing, so the provider is asked at most once per user and day. Failures
+// are only logged; the day is tried again after weatherRetryAfter.
+func recordWeatherAdjustment(ctx context.Context, userID, day string) {
+	if weatherProvider == nil {
+		return
+	}
+	if claimWeatherLookup(userID, day) {
+		fetchWeatherAdjustment(ctx, userID, day)
+	}
+}
+
+// recordWeatherAdjustmentInBackground is recordWeatherAdjustment for requests
+// that should not wait for the provider: the lookup is claimed up front and
+// only a claimed one starts a goroutine.
+func recordWeatherAdjustmentInBackground(userID, day string) {
+	if weatherProvider == nil {
+		return
+	}
+	if claimWeatherLookup(userID, day) {
+		go fetchWeatherAdjustment(context.Background(), userID, day)
+	}
+}
+
+// claimWeatherLookup reports whether the weather of day still has to be looked
+// up for the user and, if so, claims the attempt.
+func claimWeatherLookup(userID, day string) bool {
+	var recorded bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM daily_goal_adjustments WHERE user_id = $1 AND day = $2 AND source = $3)`,
+		userID, day, adjustmentSourceWeather).Scan(&recorded)
+	if err != nil {
+		log.Printf("Failed to check weather adjustment of user %s: %v", userID, err)
+		return false
+	}
+	return !recorded && claimWeatherAttempt(userID+"/"+day, time.Now())
+}
+
+// fetchWeatherAdjustment asks the provider for the weather of day at the
+// user's location and records the adjustment. Users without a location are
+// skipped.
+func fetchWeatherAdjustment(ctx context.Context, userID, day string) {
+	var lat, lon float64
+	err := db.QueryRow("SELECT latitude, longitude FROM user_locations WHERE user_id = $1", userID).Scan(&lat, &lon)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load location of user %s: %v", userID, err)
+		return
+	}
+
+	conditions, err := weatherProvider.Daily(ctx, lat, lon, day)
+	if err != nil {
+		log.Printf("Failed to fetch weather for user %s: %v", userID, err)
+		return
+	}
+	_, err = db.Exec(`INSERT INTO daily_goal_adjustments (user_id, day, source, amount, max_temp_c, humidity)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, day, source) DO NOTHING`,
+		userID, day, adjustmentSourceWeather, weather.Adjustment(conditions), conditions.MaxTempC, conditions.Humidity)
+	if err != nil {
+		log.Printf("Failed to save weather adjustment of user %s: %v", userID, err)
+	}
+}
+
+// loadDayAdjustments returns the adjustments of day that add water: the
+// recorded ones and the extra fluid of the workouts that started that day in
+// day's timezone.
+func loadDayAdjustments(userID string, day time.Time) ([]GoalAdjustment, error) {
+	rows, err := db.Query(`SELECT source, amount, max_temp_c, humidity FROM (
+			SELECT source, amount, max_temp_c, humidity FROM daily_goal_adjustments
+			WHERE user_id = $1 AND day = $2
+			UNION ALL
+			SELECT $4::varchar, SUM(extra_fluid), NULL, NULL FROM exercise_sessions
+			WHERE user_id = $1 AND (started_at AT TIME ZONE $3)::date = $2
+		) a
+		WHERE amount > 0
+		ORDER BY source`, userID, internal.DateKey(day), day.Location().String(), adjustmentSourceExercise)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	adjustments := make([]GoalAdjustment, 0)
+	for rows.Next() {
+		var a GoalAdjustment
+		if err := rows.Scan(&a.Source, &a.amountML, &a.MaxTempC, &a.Humidity); err != nil {
+			return nil, err
+		}
+		adjustments = append(adjustments, a)
+	}
+	return adjustments, rows.Err()
+}
+
+// hasAdjustment reports whether adjustments include one from source.
+func hasAdjustment(adjustments []GoalAdjustment, source string) bool {
+	for _, a := range adjustments {
+		if a.Source == source {
+			return true
+		}
+	}
+	return false
+}
+
+// loadGoalAdjustments sums the adjustments per day from from to to inclusive,
+// keyed by internal.DateKey, as loadDayAdjustments does for one day.
+func loadGoalAdjustments(userID string, from, to time.Time) (map[string]int, error) {
+	rows, err := db.Query(`SELECT day, SUM(amount) FROM (
+			SELECT day, amount FROM daily_goal_adjustments
+			WHERE user_id = $1 AND day BETWEEN $2 AND $3
+			UNION ALL
+			SELECT (started_at AT TIME ZONE $4)::date, extra_fluid FROM exercise_sessions
+			WHERE user_id = $1 AND (started_at AT TIME ZONE $4)::date BETWEEN $2 AND $3
+		) a
+		GROUP BY day`, userID, internal.DateKey(from), internal.DateKey(to), from.Location().String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	adjustments := make(map[string]int)
+	for rows.Next() {
+		var day time.Time
+		var amount int
+		if err := rows.Scan(&day, &amount); err != nil {
+			return nil, err
+		}
+		adjustments[internal.DateKey(day)] = amount
+	}
+	return adjustments, rows.Err()
+}
+
+// GetLocation godoc
+// @Summary      Get location / Получить местоположение
+// @Description  Location the weather adjustment of the daily goal is looked up for / Местоположение для поправки цели на погоду
+// @Tags         goal
+// @Produce      json
+// @Success      200   {object}  Location
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Location not set"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/location [get]
+func getLocation(c *gin.Context) {
+	var l Location
+	err := db.QueryRow("SELECT latitude, longitude, updated_at FROM user_locations WHERE user_id = $1", c.GetString("user_id")).
+		Scan(&l.Latitude, &l.Longitude, &l.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Location not set"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch location"})
+		return
+	}
+	c.JSON(http.StatusOK, l)
+}
+
+// UpdateLocation godoc
+// @Summary      Set location / Задать местоположение
+// @Description  Set the location the weather is looked up for. Days already adjusted keep their adjustment / Задать местоположение для поправки цели на погоду
+// @Tags         goal
+// @Accept       json
+// @Produce      json
+// @Param        data  body  UpdateLocationRequest  true  "Coordinates / Координаты"
+// @Success      200   {object}  Location
+// @Failure      400   {object}  ErrorResponse  "Bad Request - Invalid input"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/location [put]
+func updateLocation(c *gin.Context) {
+	var req UpdateLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var l Location
+	err := db.QueryRow(`INSERT INTO user_locations (user_id, latitude, longitude) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET latitude = $2, longitude = $3, updated_at = CURRENT_TIMESTAMP
+		RETURNING latitude, longitude, updated_at`, c.GetString("user_id"), *req.Latitude, *req.Longitude).
+		Scan(&l.Latitude, &l.Longitude, &l.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save location"})
+		return
+	}
+	c.JSON(http.StatusOK, l)
+}
+
+// DeleteLocation godoc
+// @Summary      Delete location / Удалить местоположение
+// @Description  Stop adjusting the daily goal for the weather; days already adjusted keep their adjustment / Отключить поправку цели на погоду
+// @Tags         goal
+// @Produce      json
+// @Success      200   {object}  Location  "Deleted location"
+// @Failure      401   {object}  ErrorResponse  "Unauthorized - Invalid token"
+// @Failure      404   {object}  ErrorResponse  "Location not set"
+// @Failure      500   {object}  ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /api/v1/location [delete]
+func deleteLocation(c *gin.Context) {
+	var l Location
+	err := db.QueryRow("DELETE FROM user_locations WHERE user_id = $1 RETURNING latitude, longitude, updated_at", c.GetString("user_id")).
+		Scan(&l.Latitude, &l.Longitude, &l.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Location not set"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete location"})
+		return
+	}
+	c.JSON(http.StatusOK, l)
+}
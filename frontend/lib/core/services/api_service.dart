@@ -10,6 +10,9 @@ class ApiService {
 
   late Dio _dio;
   final Logger _logger = Logger();
+
+  // In-flight token refresh shared by all requests that got a 401
+  Future<String?>? _refreshing;
   
   // Use different URLs for different platforms
   static String get baseUrl {
@@ -71,18 +74,84 @@ class ApiService {
     await prefs.setString('auth_token', token);
   }
 
+  // Get stored refresh token
+  Future<String?> _getRefreshToken() async {
+    final prefs = await SharedPreferences.getInstance();
+    return prefs.getString('refresh_token');
+  }
+
+  // Set refresh token
+  Future<void> _setRefreshToken(String token) async {
+    final prefs = await SharedPreferences.getInstance();
+    await prefs.setString('refresh_token', token);
+  }
+
   // Clear token
   Future<void> _clearToken() async {
     final prefs = await SharedPreferences.getInstance();
     await prefs.remove('auth_token');
+    await prefs.remove('refresh_token');
   }
 
-  // Add auth header to request
+  // Add auth header to request. Access tokens are short-lived: on a 401 the
+  // request is retried once with a token obtained from the refresh token.
   Future<void> _addAuthHeader(Dio dio) async {
     final token = await _getToken();
     if (token != null) {
       dio.options.headers['Authorization'] = 'Bearer $token';
     }
+
+    dio.interceptors.add(InterceptorsWrapper(
+      onError: (error, handler) async {
+        final options = error.requestOptions;
+        if (error.response?.statusCode != 401 || options.extra['retried'] == true) {
+          return handler.next(error);
+        }
+
+        final newToken = await _refreshAccessToken();
+        if (newToken == null) {
+          return handler.next(error);
+        }
+
+        options.headers['Authorization'] = 'Bearer $newToken';
+        options.extra['retried'] = true;
+        try {
+          handler.resolve(await dio.fetch(options));
+        } on DioException catch (e) {
+          handler.next(e);
+        }
+      },
+    ));
+  }
+
+  // Exchange the refresh token for a new token pair. Concurrent 401s share one
+  // request: the server treats a second use of a refresh token as theft and
+  // revokes the whole session.
+  Future<String?> _refreshAccessToken() {
+    return _refreshing ??= _refreshTokens().whenComplete(() => _refreshing = null);
+  }
+
+  Future<String?> _refreshTokens() async {
+    final refreshToken = await _getRefreshToken();
+    if (refreshToken == null) {
+      return null;
+    }
+
+    try {
+      final response = await _dio.post('/refresh', data: {
+        'refresh_token': refreshToken,
+      });
+      final data = response.data;
+      await _setToken(data['token']);
+      await _setRefreshToken(data['refresh_token']);
+      return data['token'];
+    } on DioException catch (e) {
+      // A rejected refresh token means the session is over
+      if (e.response?.statusCode == 401) {
+        await _clearToken();
+      }
+      return null;
+    }
   }
 
   // Auth API Methods
@@ -117,6 +186,9 @@ class ApiService {
       if (data['token'] != null) {
         await _setToken(data['token']);
       }
+      if (data['refresh_token'] != null) {
+        await _setRefreshToken(data['refresh_token']);
+      }
       
       return data;
     } on DioException catch (e) {
@@ -142,7 +214,7 @@ class ApiService {
     }
   }
 
-  Future<List<Map<String, dynamic>>> getHydrationEntries() async {
+  Future<List<Map<String, dynamic>>> getHydrationEntries({int limit = 20}) async {
     try {
       final hydrationDio = Dio(BaseOptions(
         baseUrl: hydrationBaseUrl,
@@ -155,8 +227,9 @@ class ApiService {
 
       await _addAuthHeader(hydrationDio);
       
-      final response = await hydrationDio.get('/entries');
-      return List<Map<String, dynamic>>.from(response.data);
+      // The endpoint is paginated; the dashboard only needs the newest entries
+      final response = await hydrationDio.get('/entries', queryParameters: {'limit': limit});
+      return List<Map<String, dynamic>>.from(response.data['entries']);
     } on DioException catch (e) {
       throw _handleDioError(e);
     }
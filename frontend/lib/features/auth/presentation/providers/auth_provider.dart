@@ -102,9 +102,9 @@ class AuthNotifier extends StateNotifier<AuthState> {
       final profile = await _apiService.getProfile();
       state = state.copyWith(
         user: User(
-          id: profile['user_id'],
+          id: profile['id'],
           username: profile['username'],
-          email: '', // Profile endpoint doesn't return email
+          email: profile['email'] ?? '',
         ),
       );
     } catch (error) {